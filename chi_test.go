@@ -0,0 +1,59 @@
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestHandlerChi(t *testing.T) {
+	called := false
+	r := chi.NewRouter()
+	r.Use(Handler(New(WithOrigins("https://example.com"), WithMethods(http.MethodGet, http.MethodPost))))
+	r.Get("/items", func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, newRequest(http.MethodGet, "https://example.com", t))
+	validateHeaders("https://example.com", "GET, POST", "", "", recorder, t)
+
+	req := newRequest(http.MethodGet, "https://example.com", t)
+	req.URL.Path = "/items"
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, req)
+	validateHeaders("https://example.com", "GET, POST", "", "", recorder, t)
+	if !called {
+		t.Fatal("route handler not called")
+	}
+
+	req = newPreflightRequest("https://example.com", http.MethodPost, t)
+	req.URL.Path = "/items"
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatal("unexpected preflight status:", recorder.Code)
+	}
+}
+
+func Example_chiRouter() {
+	r := chi.NewRouter()
+	r.Use(Handler(New(
+		WithOrigins("https://app.example.com"),
+		WithMethods(http.MethodGet, http.MethodPost),
+		WithHeaders("Content-Type"),
+	)))
+	r.Get("/items", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "items")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	fmt.Println(w.Header().Get("Access-Control-Allow-Origin"), w.Body.String())
+	// Output: https://app.example.com items
+}
@@ -1,19 +1,101 @@
 package cors
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 )
 
 // Cors holds the functions and data configured and provide the middleware
-// used for CORS (Cross-origin resource sharing).
+// used for CORS (Cross-origin resource sharing). A Cors is safe for
+// concurrent use and can be reconfigured while serving requests with Update.
 type Cors struct {
-	allowedOrigins string
-	allowedHeaders string
-	allowedMethods string
-	maxAge         string
+	mu     sync.RWMutex
+	frozen bool
+	config
+}
+
+// config holds the configured data of a Cors. It is embedded in Cors so
+// ConfigFuncs can set the fields directly.
+type config struct {
+	originValidator   func(origin string) bool
+	allowAllOrigins   bool
+	allowedOrigins    []string
+	originPatterns    []*regexp.Regexp
+	portAgnostic      bool
+	allowNull         bool
+	httpsOnly         bool
+	rejectIPs         bool
+	strict            bool
+	deferExisting     bool
+	allowedHeaders    string
+	reflectHeaders    bool
+	headersFunc       func(r *http.Request) []string
+	allowedMethods    string
+	originMethods     map[string]string
+	methodsFunc       func(r *http.Request) []string
+	exposedHeaders    string
+	timingAll         bool
+	timingOrigins     []string
+	vary              []string
+	maxAge            string
+	capMaxAge         bool
+	maxAgeHeader      string
+	credentials       bool
+	privateNetwork    bool
+	optionalOrigin    bool
+	preflightStatus   int
+	omitContentLength bool
+	passthrough       bool
+	logger            func(r *http.Request, decision string)
+	slogger           func(r *http.Request, decision string)
+	metrics           func(decision string)
+	debug             Logger
+	handler           http.Handler
+	values            map[string][]string
+	rejected          http.HandlerFunc
+	ids               funcIDs
+	errs              []error
+}
+
+// funcIDs identify the functions and handler of a configuration for Equal,
+// as functions can't be compared. A function given in a ConfigFunc gets a
+// new identity, which is shared by the clones of the configuration, while
+// the functions built around a *slog.Logger, a *Metrics or a pointer
+// handler are identified by it.
+type funcIDs struct {
+	validator, headers, methods, logger, slogger, metrics, handler, rejected interface{}
+}
+
+// funcID is the identity of a function, see funcIDs. It isn't zero-sized
+// so that every new funcID has a distinct address.
+type funcID byte
+
+// identity returns the value identifying v in funcIDs: nil for nil, the
+// pointer itself for a pointer and a new funcID for anything else.
+func identity(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch {
+	case !rv.IsValid() || (rv.Kind() == reflect.Func || rv.Kind() == reflect.Ptr) && rv.IsNil():
+		return nil
+	case rv.Kind() == reflect.Ptr:
+		return v
+	}
+
+	return new(funcID)
 }
 
 // ConfigFunc is the type of function used to configure the Cors
@@ -26,67 +108,2070 @@ type ConfigFunc func(*Cors)
 func New(configs ...ConfigFunc) *Cors {
 	c := &Cors{}
 
-	for _, cFn := range configs {
-		cFn(c)
+	for _, cFn := range configs {
+		cFn(c)
+	}
+	c.prepare()
+
+	return c
+}
+
+// AllowAll creates a new Cors instance configured with WithAllowAll,
+// accepting requests from any origin. It is unsafe for production use and
+// only meant for prototyping and development.
+func AllowAll() *Cors {
+	return New(WithAllowAll())
+}
+
+// Secure creates a new Cors instance with conservative defaults to start
+// from and narrow with Update or Clone: no origins are accepted, only the
+// GET, HEAD and POST methods are accepted, the CORS information may be
+// cached for 10 minutes and credentials are not allowed.
+func Secure() *Cors {
+	return New(
+		WithMethods(http.MethodGet, http.MethodHead, http.MethodPost),
+		WithMaxAge(10*time.Minute),
+		WithCredentials(false),
+	)
+}
+
+// GRPCWeb creates a new Cors instance for serving gRPC-Web to browsers from
+// the given origins: POST requests are accepted with the headers sent by
+// the gRPC-Web clients, and the Grpc-Status and Grpc-Message headers, which
+// carry the result of calls that fail without a response message, are
+// exposed to them.
+func GRPCWeb(origins ...string) *Cors {
+	return New(
+		WithOrigins(origins...),
+		WithMethods(http.MethodPost),
+		WithHeaders("Content-Type", "X-Grpc-Web", "X-User-Agent", "Grpc-Timeout"),
+		WithExposedHeaders("Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin"),
+	)
+}
+
+// Permissive returns the ConfigFuncs for a development setup, the same as
+// WithAllowAll. Any page on the web can call the API, but without
+// credentials, so it must only be used where nothing sensitive is exposed.
+func Permissive() []ConfigFunc {
+	return []ConfigFunc{WithAllowAll()}
+}
+
+// Strict returns the ConfigFuncs for a production setup serving
+// authenticated clients: credentials are allowed and only GET, POST and
+// OPTIONS requests are accepted. It doesn't accept any origins, they must
+// be added explicitly with WithOrigins, before or after the preset, so
+// credentials are only ever shared with the known origins.
+func Strict() []ConfigFunc {
+	return []ConfigFunc{
+		WithMethods(http.MethodGet, http.MethodPost, http.MethodOptions),
+		WithCredentials(true),
+	}
+}
+
+// API returns the ConfigFuncs for a JSON REST API: the GET, POST, PUT,
+// PATCH and DELETE methods and the Content-Type and Authorization headers
+// are accepted, while credentials (cookies) are not - clients authenticate
+// with the Authorization header. No origins are accepted, they must be
+// added with WithOrigins.
+func API() []ConfigFunc {
+	return []ConfigFunc{
+		WithMethods(http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete),
+		WithHeaders("Content-Type", "Authorization"),
+		WithCredentials(false),
+	}
+}
+
+// Config is a plain description of a Cors configuration, convenient when
+// the configuration is loaded from a file or the environment. See FromConfig.
+type Config struct {
+	Origins        []string
+	Methods        []string
+	Headers        []string
+	MaxAgeSecs     int
+	Credentials    bool
+	ExposedHeaders []string
+}
+
+// FromConfig creates a new Cors instance configured as described by cfg. The
+// configuration is checked like NewWithError does and any problem is
+// returned as an error.
+func FromConfig(cfg Config) (*Cors, error) {
+	configs := []ConfigFunc{WithCredentials(cfg.Credentials)}
+	if len(cfg.Origins) > 0 {
+		configs = append(configs, WithOrigins(cfg.Origins...))
+	}
+	if len(cfg.Methods) > 0 {
+		configs = append(configs, WithMethods(cfg.Methods...))
+	}
+	if len(cfg.Headers) > 0 {
+		configs = append(configs, WithHeaders(cfg.Headers...))
+	}
+	if cfg.MaxAgeSecs != 0 {
+		configs = append(configs, WithMaxAge(time.Duration(cfg.MaxAgeSecs)*time.Second))
+	}
+	if len(cfg.ExposedHeaders) > 0 {
+		configs = append(configs, WithExposedHeaders(cfg.ExposedHeaders...))
+	}
+
+	return NewWithError(configs...)
+}
+
+// Update applies the given ConfigFuncs to the Cors. It is safe to call
+// while the Cors is serving requests, requests that are already being
+// handled keep the configuration they started with.
+func (c *Cors) Update(configs ...ConfigFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.mustNotBeFrozen("Update")
+
+	for _, cFn := range configs {
+		cFn(c)
+	}
+	c.prepare()
+}
+
+// Reset clears the configuration of the Cors, leaving it as if created by
+// New without any ConfigFuncs, so it can be configured again with Update.
+// The handler set with Mount is kept, as it isn't part of the CORS policy.
+// Like Update it is safe to call while the Cors is serving requests.
+func (c *Cors) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.mustNotBeFrozen("Reset")
+
+	c.config = config{handler: c.handler, ids: funcIDs{handler: c.ids.handler}}
+	c.prepare()
+}
+
+// Freeze makes the configuration of the Cors final, so later calls to
+// Update, SetOrigins or Reset panic instead of changing the policy of every
+// handler sharing it. Use Clone to get an unfrozen copy. It returns the
+// Cors to allow chaining.
+func (c *Cors) Freeze() *Cors {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.frozen = true
+	return c
+}
+
+// mustNotBeFrozen panics if the Cors has been frozen with Freeze. It must
+// be called with the lock held.
+func (c *Cors) mustNotBeFrozen(method string) {
+	if c.frozen {
+		panic("cors: " + method + " called on a frozen Cors, use Clone to get a copy that can be changed")
+	}
+}
+
+// SetOrigins replaces the accepted origins like Update(WithOrigins(...)),
+// for swapping the allowlist while the Cors is serving requests, e.g. when
+// it is loaded from a configuration service.
+func (c *Cors) SetOrigins(origins ...string) {
+	c.Update(WithOrigins(origins...))
+}
+
+// snapshot returns a copy of the current configuration.
+func (c *Cors) snapshot() config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.config
+}
+
+// clone returns a copy of the configuration that doesn't share any slices
+// with the original.
+func (c config) clone() config {
+	c.allowedOrigins = append([]string(nil), c.allowedOrigins...)
+	c.originPatterns = append([]*regexp.Regexp(nil), c.originPatterns...)
+	c.timingOrigins = append([]string(nil), c.timingOrigins...)
+	c.vary = append([]string(nil), c.vary...)
+	c.errs = append([]error(nil), c.errs...)
+	if c.originMethods != nil {
+		m := make(map[string]string, len(c.originMethods))
+		for o, methods := range c.originMethods {
+			m[o] = methods
+		}
+		c.originMethods = m
+	}
+
+	return c
+}
+
+// NewWithError works like New but checks the configuration with Validate
+// and returns any problem found as an error. A ConfigFunc that panics on
+// invalid input, like WithOrigins given a malformed wildcard, also results
+// in an error.
+func NewWithError(configs ...ConfigFunc) (c *Cors, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c = nil
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	c = New(configs...)
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Clone returns a copy of the Cors with the given ConfigFuncs applied to
+// it. The original Cors isn't changed.
+func (c *Cors) Clone(overrides ...ConfigFunc) *Cors {
+	n := &Cors{config: c.snapshot().clone()}
+
+	for _, cFn := range overrides {
+		cFn(n)
+	}
+	n.prepare()
+
+	return n
+}
+
+// Merge returns a new Cors starting from a copy of base where every field
+// that is set in an override replaces the value from base, applying the
+// overrides in order. Fields that aren't set in an override don't clear the
+// value from base. None of the given Cors instances are changed.
+func Merge(base *Cors, overrides ...*Cors) *Cors {
+	if base == nil {
+		base = New()
+	}
+	m := base.Clone()
+
+	for _, oc := range overrides {
+		if oc == nil {
+			continue
+		}
+		o := oc.snapshot()
+		if o.allowAllOrigins || len(o.allowedOrigins) > 0 {
+			m.allowAllOrigins = o.allowAllOrigins
+			m.allowedOrigins = append([]string(nil), o.allowedOrigins...)
+		}
+		if len(o.originPatterns) > 0 {
+			m.originPatterns = append([]*regexp.Regexp(nil), o.originPatterns...)
+		}
+		if o.originValidator != nil {
+			m.originValidator, m.ids.validator = o.originValidator, o.ids.validator
+		}
+		if o.portAgnostic {
+			m.portAgnostic = true
+		}
+		if o.allowNull {
+			m.allowNull = true
+		}
+		if o.httpsOnly {
+			m.httpsOnly = true
+		}
+		if o.rejectIPs {
+			m.rejectIPs = true
+		}
+		if o.deferExisting {
+			m.deferExisting = true
+		}
+		if o.allowedMethods != "" {
+			m.allowedMethods = o.allowedMethods
+		}
+		for origin, methods := range o.originMethods {
+			if m.originMethods == nil {
+				m.originMethods = map[string]string{}
+			}
+			m.originMethods[origin] = methods
+		}
+		if o.allowedHeaders != "" {
+			m.allowedHeaders = o.allowedHeaders
+		}
+		if o.reflectHeaders {
+			m.reflectHeaders = true
+		}
+		if o.headersFunc != nil {
+			m.headersFunc, m.ids.headers = o.headersFunc, o.ids.headers
+		}
+		if o.methodsFunc != nil {
+			m.methodsFunc, m.ids.methods = o.methodsFunc, o.ids.methods
+		}
+		if o.exposedHeaders != "" {
+			m.exposedHeaders = o.exposedHeaders
+		}
+		if o.timingAll || len(o.timingOrigins) > 0 {
+			m.timingAll = o.timingAll
+			m.timingOrigins = append([]string(nil), o.timingOrigins...)
+		}
+		if len(o.vary) > 0 {
+			m.vary = append([]string(nil), o.vary...)
+		}
+		if o.maxAge != "" {
+			m.maxAge = o.maxAge
+		}
+		if o.capMaxAge {
+			m.capMaxAge = true
+		}
+		if o.credentials {
+			m.credentials = true
+		}
+		if o.privateNetwork {
+			m.privateNetwork = true
+		}
+		if o.optionalOrigin {
+			m.optionalOrigin = true
+		}
+		if o.passthrough {
+			m.passthrough = true
+		}
+		if o.preflightStatus != 0 {
+			m.preflightStatus = o.preflightStatus
+		}
+		if o.omitContentLength {
+			m.omitContentLength = true
+		}
+		if o.logger != nil {
+			m.logger, m.ids.logger = o.logger, o.ids.logger
+		}
+		if o.slogger != nil {
+			m.slogger, m.ids.slogger = o.slogger, o.ids.slogger
+		}
+		if o.metrics != nil {
+			m.metrics, m.ids.metrics = o.metrics, o.ids.metrics
+		}
+		if o.debug != nil {
+			m.debug = o.debug
+		}
+		if o.handler != nil {
+			m.handler, m.ids.handler = o.handler, o.ids.handler
+		}
+		if o.rejected != nil {
+			m.rejected, m.ids.rejected = o.rejected, o.ids.rejected
+		}
+		if o.strict {
+			m.strict = true
+		}
+		m.errs = append(m.errs, o.errs...)
+	}
+	m.prepare()
+
+	return m
+}
+
+// Merge returns a new Cors combining c and other, for composing the CORS
+// rules of several parts of an application. Unlike the Merge function,
+// which lets later values replace earlier ones, the origins, methods,
+// headers and exposed headers of both are combined, and the larger max age
+// is used. The boolean options, like credentials, are enabled if enabled in
+// either, and any other value set in other, like the origin validator,
+// takes precedence. Neither c nor other is changed.
+func (c *Cors) Merge(other *Cors) *Cors {
+	m := Merge(c, other)
+	if other == nil {
+		return m
+	}
+
+	a, b := c.snapshot(), other.snapshot()
+	m.allowAllOrigins = a.allowAllOrigins || b.allowAllOrigins
+	m.allowedOrigins = nil
+	if !m.allowAllOrigins {
+		m.allowedOrigins = unionStrings(a.allowedOrigins, b.allowedOrigins)
+	}
+	m.originPatterns = append([]*regexp.Regexp(nil), a.originPatterns...)
+	for _, p := range b.originPatterns {
+		if !containsPattern(m.originPatterns, p) {
+			m.originPatterns = append(m.originPatterns, p)
+		}
+	}
+	m.timingAll = a.timingAll || b.timingAll
+	m.timingOrigins = nil
+	if !m.timingAll {
+		m.timingOrigins = unionStrings(a.timingOrigins, b.timingOrigins)
+	}
+	m.allowedMethods = unionList(a.allowedMethods, b.allowedMethods)
+	m.allowedHeaders = unionList(a.allowedHeaders, b.allowedHeaders)
+	m.exposedHeaders = unionList(a.exposedHeaders, b.exposedHeaders)
+	m.vary = unionStrings(a.vary, b.vary)
+	m.maxAge = largerMaxAge(a.maxAge, b.maxAge)
+	m.prepare()
+
+	return m
+}
+
+// unionStrings returns the values of a followed by those of b that aren't
+// in a.
+func unionStrings(a, b []string) []string {
+	u := append([]string(nil), a...)
+	for _, v := range b {
+		if !containsString(u, v) {
+			u = append(u, v)
+		}
+	}
+
+	return u
+}
+
+// unionList returns the union of two comma separated lists. The union with
+// "*" is "*".
+func unionList(a, b string) string {
+	if a == "*" || b == "*" {
+		return "*"
+	}
+
+	var values []string
+	for _, list := range []string{a, b} {
+		for _, v := range strings.Split(list, ",") {
+			if v = strings.TrimSpace(v); v != "" && !containsString(values, v) {
+				values = append(values, v)
+			}
+		}
+	}
+
+	return strings.Join(values, ", ")
+}
+
+// containsPattern reports whether a pattern with the same source as p is
+// in patterns.
+func containsPattern(patterns []*regexp.Regexp, p *regexp.Regexp) bool {
+	for _, q := range patterns {
+		if q.String() == p.String() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// largerMaxAge returns the larger of two max age values, ignoring unset
+// values.
+func largerMaxAge(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+
+	x, _ := strconv.Atoi(a)
+	y, _ := strconv.Atoi(b)
+	if y > x {
+		return b
+	}
+
+	return a
+}
+
+// Equal reports whether a and b are configured the same way, e.g. to
+// decide whether a newly built policy needs to be deployed. The origins,
+// methods and headers are compared in the order they were given. Two nil
+// Cors are equal. Functions can't be compared, so those given in
+// ConfigFuncs, like the origin validator, are only equal if they were set
+// by the same ConfigFunc value, e.g. in a Cors and its clones. Loggers and
+// metrics given with WithSlogLogger, WithMetrics and WithDebugLogger are
+// compared by the *slog.Logger, *Metrics or Logger they write to.
+func Equal(a, b *Cors) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a == b {
+		return true
+	}
+
+	x, y := a.snapshot(), b.snapshot()
+	if x.ids != y.ids || !x.identified() || !y.identified() || !sameLogger(x.debug, y.debug) {
+		return false
+	}
+	if len(x.originPatterns) != len(y.originPatterns) || len(x.errs) != len(y.errs) {
+		return false
+	}
+	for i, p := range x.originPatterns {
+		if p.String() != y.originPatterns[i].String() {
+			return false
+		}
+	}
+	for i, err := range x.errs {
+		if err.Error() != y.errs[i].Error() {
+			return false
+		}
+	}
+
+	return reflect.DeepEqual(x.comparable(), y.comparable())
+}
+
+// identified reports whether every function of the configuration has an
+// identity in ids, which isn't the case for functions set directly.
+func (c *config) identified() bool {
+	return (c.originValidator == nil) == (c.ids.validator == nil) &&
+		(c.headersFunc == nil) == (c.ids.headers == nil) &&
+		(c.methodsFunc == nil) == (c.ids.methods == nil) &&
+		(c.logger == nil) == (c.ids.logger == nil) &&
+		(c.slogger == nil) == (c.ids.slogger == nil) &&
+		(c.metrics == nil) == (c.ids.metrics == nil) &&
+		(c.handler == nil) == (c.ids.handler == nil) &&
+		(c.rejected == nil) == (c.ids.rejected == nil)
+}
+
+// comparable returns a copy of the configuration without the fields that
+// Equal compares separately, and with empty slices and maps set to nil.
+func (c config) comparable() config {
+	c.originValidator, c.headersFunc, c.methodsFunc = nil, nil, nil
+	c.logger, c.slogger, c.metrics, c.rejected = nil, nil, nil, nil
+	c.handler, c.debug, c.ids = nil, nil, funcIDs{}
+	c.originPatterns, c.errs, c.values = nil, nil, nil
+	if len(c.allowedOrigins) == 0 {
+		c.allowedOrigins = nil
+	}
+	if len(c.timingOrigins) == 0 {
+		c.timingOrigins = nil
+	}
+	if len(c.vary) == 0 {
+		c.vary = nil
+	}
+	if len(c.originMethods) == 0 {
+		c.originMethods = nil
+	}
+
+	return c
+}
+
+// sameLogger reports whether a and b are the same Logger. Pointers are
+// compared by address and other values deeply, except functions which
+// can't be compared and are only equal if both are nil.
+func sameLogger(a, b Logger) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	x, y := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch {
+	case x.Type() != y.Type() || x.Kind() == reflect.Func:
+		return false
+	case x.Kind() == reflect.Ptr:
+		return x.Pointer() == y.Pointer()
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// AllowedOrigins returns a copy of the configured origins, in their
+// normalized form. If all origins are accepted it returns "*" alone.
+func (c *Cors) AllowedOrigins() []string {
+	cfg := c.snapshot()
+	if cfg.allowAllOrigins {
+		return []string{"*"}
+	}
+
+	return append([]string(nil), cfg.allowedOrigins...)
+}
+
+// AllowedMethods returns the configured methods.
+func (c *Cors) AllowedMethods() []string {
+	return splitList(c.snapshot().allowedMethods)
+}
+
+// AllowedHeaders returns the configured headers.
+func (c *Cors) AllowedHeaders() []string {
+	return splitList(c.snapshot().allowedHeaders)
+}
+
+// MaxAge returns the configured max age. It is negative if the CORS
+// information must not be cached and zero if no max age is configured.
+func (c *Cors) MaxAge() time.Duration {
+	n, _ := strconv.Atoi(c.snapshot().maxAge)
+	return time.Duration(n) * time.Second
+}
+
+// splitList returns the values of a comma separated list.
+func splitList(list string) []string {
+	var values []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+// String returns a human-readable description of the configuration,
+// useful for logging.
+func (c *Cors) String() string {
+	cfg := c.snapshot()
+	return fmt.Sprintf("Cors{origins: %q, methods: %q, headers: %q, maxAge: %q, credentials: %t, exposedHeaders: %q}",
+		cfg.origins(), cfg.allowedMethods, cfg.allowedHeaders, cfg.maxAge, cfg.credentials, cfg.exposedHeaders)
+}
+
+// Validate checks the configuration of the Cors instance and returns an
+// error if it describes a combination that browsers will reject or that is
+// most likely a mistake, like accepting no origins at all or malformed
+// origins, or if any of the ConfigFuncs was given invalid input. When
+// several problems are found the returned error describes all of them.
+func (c *Cors) Validate() error {
+	cfg := c.snapshot()
+	errs := append([]error(nil), cfg.errs...)
+
+	if cfg.credentials && cfg.allowAllOrigins {
+		errs = append(errs, errors.New("cors: credentials cannot be allowed with a wildcard (\"*\") origin"))
+	}
+	if !cfg.allowAllOrigins && len(cfg.allowedOrigins) == 0 && len(cfg.originPatterns) == 0 &&
+		cfg.originValidator == nil {
+		errs = append(errs, errors.New("cors: no origins are allowed"))
+	}
+	if cfg.httpsOnly {
+		for _, o := range append(append([]string(nil), cfg.allowedOrigins...), cfg.timingOrigins...) {
+			if strings.HasPrefix(o, "http://") {
+				errs = append(errs, fmt.Errorf("cors: origin %q isn't allowed when only HTTPS origins are accepted", o))
+			}
+		}
+	}
+	seen := map[string]bool{}
+	for _, m := range strings.Split(cfg.allowedMethods, ",") {
+		m = strings.TrimSpace(m)
+		if m != "" && seen[m] {
+			errs = append(errs, fmt.Errorf("cors: duplicate method %q", m))
+		}
+		seen[m] = true
+	}
+	if cfg.allowedHeaders != "" && cfg.allowedMethods == "" {
+		errs = append(errs, errors.New("cors: headers are allowed but no methods are"))
+	}
+	if cfg.maxAge != "" && cfg.allowedMethods == "" && cfg.allowedHeaders == "" {
+		errs = append(errs, errors.New("cors: max age is set but no methods or headers are allowed"))
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return validationErrors(errs)
+	}
+}
+
+// validationErrors is returned by Validate when more than one problem is
+// found.
+type validationErrors []error
+
+func (e validationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+func (e validationErrors) Unwrap() []error {
+	return e
+}
+
+// Wrap returns a http.Handler that applies the CORS headers to the response
+// before calling the given handler. Preflight requests - OPTIONS requests
+// with an Access-Control-Request-Method header - are answered directly.
+func (c *Cors) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := c.requestConfig(r)
+		cfg.serve(w, r, h)
+	})
+}
+
+// WrapFunc works like Wrap but takes and returns a http.HandlerFunc, making
+// it convenient to use with http.HandleFunc.
+func (c *Cors) WrapFunc(fn http.HandlerFunc) http.HandlerFunc {
+	return c.Wrap(fn).ServeHTTP
+}
+
+// Mount sets the handler that is called by ServeHTTP, allowing the Cors to
+// be used directly as the root handler of a server. It returns the Cors to
+// allow chaining.
+func (c *Cors) Mount(h http.Handler) *Cors {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.handler, c.ids.handler = h, identity(h)
+	return c
+}
+
+// ServeHTTP applies the CORS headers to the response and calls the handler
+// set with Mount. If no handler is mounted the Cors only answers preflight
+// requests, and other requests get 405 Method Not Allowed with an Allow
+// header listing the configured methods. This allows using a Cors directly
+// as a preflight handler, e.g. mux.Handle("/api/", c).
+func (c *Cors) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cfg := c.requestConfig(r)
+	h := c.snapshot().handler
+	if h == nil {
+		h = methodNotAllowed(cfg.allowedMethods)
+	}
+	cfg.serve(w, r, h)
+}
+
+// methodNotAllowed returns a handler answering all requests with 405 Method
+// Not Allowed, listing the allowed methods in the Allow header. The header
+// is left out if any method is allowed, as "*" isn't a valid Allow value.
+func methodNotAllowed(methods string) http.Handler {
+	if methods == "" {
+		methods = http.MethodOptions
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if methods != "*" {
+			w.Header().Set("Allow", methods)
+		}
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	})
+}
+
+// Apply sets the CORS headers on the response for the request without
+// calling any handler, for use in handler chains that control the response
+// themselves. Preflight requests are answered like Wrap does and Apply
+// returns true, in which case the caller must not write to w. The same goes
+// for rejected requests when configured with WithRejectionHandler or
+// WithStrictOrigin. For all other requests - and for preflight requests
+// when configured with WithOptionsPassthrough - only the headers are set
+// and Apply returns false.
+func (c *Cors) Apply(w http.ResponseWriter, r *http.Request) (isPreflight bool) {
+	cfg := c.requestConfig(r)
+	decision, answered := cfg.apply(w, r)
+	defer cfg.log(r, decision)
+
+	if !answered && cfg.rejects(r, decision) {
+		cfg.reject(w, r)
+		return true
+	}
+
+	return answered
+}
+
+// ApplyPreflight sets the headers of a response to a preflight request and
+// answers it with the configured status, regardless of the method of r.
+// Unlike Apply it doesn't check whether the request has an Origin header.
+func (c *Cors) ApplyPreflight(w http.ResponseWriter, r *http.Request) {
+	cfg := c.requestConfig(r)
+	cfg.applyVary(w)
+	decision := cfg.applyPreflight(w, r)
+	cfg.writePreflightStatus(w)
+	cfg.log(r, decision)
+}
+
+// ApplyActual sets the headers of a response to a request that isn't a
+// preflight request, leaving the rest of the response to the caller.
+// Unlike Apply it doesn't check whether the request has an Origin header.
+func (c *Cors) ApplyActual(w http.ResponseWriter, r *http.Request) {
+	cfg := c.requestConfig(r)
+	cfg.applyVary(w)
+	cfg.log(r, cfg.applyActual(w, r))
+}
+
+// contextKey is the type of the key used to store an override in a
+// context.
+type contextKey struct{}
+
+// WithContextOverride returns a copy of ctx carrying cfg, making Wrap and
+// ServeHTTP use the configuration of cfg instead of their own for requests
+// with the returned context. This allows an earlier middleware to select
+// the CORS policy per request.
+func WithContextOverride(ctx context.Context, cfg *Cors) context.Context {
+	return context.WithValue(ctx, contextKey{}, cfg)
+}
+
+// ContextOverride returns the Cors stored in ctx by WithContextOverride, if
+// any.
+func ContextOverride(ctx context.Context) (*Cors, bool) {
+	cfg, ok := ctx.Value(contextKey{}).(*Cors)
+	return cfg, ok && cfg != nil
+}
+
+// requestConfig returns the configuration to use for the request, which is
+// the override from the request context if there is one.
+func (c *Cors) requestConfig(r *http.Request) config {
+	if r != nil {
+		if o, ok := ContextOverride(r.Context()); ok {
+			return o.snapshot()
+		}
+	}
+
+	return c.snapshot()
+}
+
+// serve applies the CORS headers to the response and either answers the
+// preflight request or calls h.
+func (c *config) serve(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	var dw *deferringWriter
+	if c.deferExisting {
+		dw = &deferringWriter{ResponseWriter: w, pending: http.Header{}}
+		defer dw.merge()
+		w = dw
+	}
+
+	decision, answered := c.apply(w, r)
+	defer c.log(r, decision)
+	if dw != nil {
+		dw.applied = true
+	}
+
+	if answered {
+		return
+	}
+	if c.rejects(r, decision) {
+		c.reject(w, r)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+// apply sets the CORS headers on the response and answers preflight
+// requests, reporting the decision made for the request and whether the
+// response has been written. Requests without an Origin header aren't CORS
+// requests and are left untouched unless configured otherwise with
+// WithRequireOriginHeader.
+func (c *config) apply(w http.ResponseWriter, r *http.Request) (decision string, answered bool) {
+	c.applyVary(w)
+
+	if r == nil || (r.Header.Get("Origin") == "" && !c.optionalOrigin) {
+		c.debugf("cors: no Origin header, not a CORS request")
+		return "no-origin", false
+	}
+
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		return c.applyActual(w, r), false
+	}
+
+	decision = c.applyPreflight(w, r)
+	if c.passthrough || c.rejects(r, decision) {
+		return decision, false
+	}
+	c.writePreflightStatus(w)
+
+	return decision, true
+}
+
+// rejects reports whether the request is kept from the wrapped handler
+// because of the decision made for it, which is the case for rejected
+// requests with a rejection handler or in strict mode. Strict mode lets
+// same-origin requests through.
+func (c *config) rejects(r *http.Request, decision string) bool {
+	return decision == "rejected" && (c.rejected != nil || c.strict && !sameOrigin(r))
+}
+
+// reject answers a request rejected according to rejects, using the
+// rejection handler if there is one.
+func (c *config) reject(w http.ResponseWriter, r *http.Request) {
+	if c.rejected != nil {
+		c.rejected(w, r)
+		return
+	}
+
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+}
+
+// sameOrigin reports whether the Origin header of the request names the
+// host the request was sent to. The scheme isn't compared as it isn't
+// known behind a TLS terminating proxy.
+func sameOrigin(r *http.Request) bool {
+	u, err := url.Parse(r.Header.Get("Origin"))
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// applyVary adds the Origin to the Vary header of the response if the
+// response depends on it, followed by the names given with WithVary.
+func (c *config) applyVary(w http.ResponseWriter) {
+	if c.variesByOrigin() {
+		c.addVary(w.Header(), "Origin")
+	}
+	for _, v := range c.vary {
+		c.addVary(w.Header(), v)
+	}
+}
+
+// applyPreflight sets the headers of a response to a preflight request and
+// returns the decision made for it.
+func (c *config) applyPreflight(w http.ResponseWriter, r *http.Request) string {
+	defer c.debugHeaders(w, r)
+
+	allowOrigin := c.applyOrigin(w, r)
+
+	allowedHeaders := c.allowedHeaders
+	if c.headersFunc != nil {
+		if headers := c.headersFunc(r); len(headers) > 0 {
+			allowedHeaders = unionList(allowedHeaders, joinNormalized(headers, http.CanonicalHeaderKey))
+		}
+	}
+	if c.reflectHeaders || (c.credentials && allowedHeaders == "*") {
+		c.addVary(w.Header(), "Access-Control-Request-Headers")
+		if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			allowedHeaders = requested
+		}
+	}
+
+	allowedMethods := c.methodsFor(r, allowOrigin)
+	if c.methodsFunc != nil {
+		if methods := c.methodsFunc(r); len(methods) > 0 {
+			allowedMethods = unionList(allowedMethods, joinNormalized(methods, strings.ToUpper))
+		}
+	}
+	requested := r.Header.Get("Access-Control-Request-Method")
+	if allowedMethods == "*" && c.credentials {
+		c.addVary(w.Header(), "Access-Control-Request-Method")
+		allowedMethods = requested
+	}
+	if allowedMethods != "*" && !listContains(allowedMethods, requested) {
+		if c.debug != nil {
+			c.debugf("cors: %s %s: preflight denied, method %q is not in %q", r.Method, r.URL.Path, requested, allowedMethods)
+		}
+		allowedMethods = ""
+	} else if allowOrigin != "" && c.debug != nil {
+		c.debugf("cors: %s %s: preflight allowed for method %q", r.Method, r.URL.Path, requested)
+	}
+
+	c.applyAllowed(w, allowedMethods, allowedHeaders)
+	if c.maxAgeHeader != "" {
+		c.setHeader(w.Header(), "Access-Control-Max-Age", c.maxAgeHeader)
+	}
+	if c.privateNetwork && r.Header.Get("Access-Control-Request-Private-Network") == "true" {
+		c.setHeader(w.Header(), "Access-Control-Allow-Private-Network", "true")
+	}
+
+	return decide(r, allowOrigin, "preflight")
+}
+
+// applyActual sets the headers of a response to a request that isn't a
+// preflight request and returns the decision made for it.
+func (c *config) applyActual(w http.ResponseWriter, r *http.Request) string {
+	defer c.debugHeaders(w, r)
+
+	allowOrigin := c.applyOrigin(w, r)
+	c.applyAllowed(w, c.methodsFor(r, allowOrigin), c.allowedHeaders)
+	if c.exposedHeaders != "" {
+		c.setHeader(w.Header(), "Access-Control-Expose-Headers", c.exposedHeaders)
+	}
+	if timing := c.timingOrigin(r.Header.Get("Origin")); timing != "" {
+		c.setHeader(w.Header(), "Timing-Allow-Origin", timing)
+	}
+
+	return decide(r, allowOrigin, "allowed")
+}
+
+// decide returns the decision for a request given the value of its
+// Access-Control-Allow-Origin header. Requests without an Origin header
+// are "no-origin" even when they get CORS headers, as configured with
+// WithRequireOriginHeader, so they are never rejected.
+func decide(r *http.Request, allowOrigin, accepted string) string {
+	switch {
+	case r.Header.Get("Origin") == "":
+		return "no-origin"
+	case allowOrigin == "":
+		return "rejected"
+	}
+	return accepted
+}
+
+// applyOrigin sets the Access-Control-Allow-Origin header if the origin of
+// the request is accepted and returns its value.
+func (c *config) applyOrigin(w http.ResponseWriter, r *http.Request) string {
+	origin := r.Header.Get("Origin")
+	allowOrigin := c.allowedOrigin(origin)
+	if allowOrigin != "" {
+		if c.debug != nil {
+			c.debugf("cors: %s %s: origin %q accepted", r.Method, r.URL.Path, origin)
+		}
+		c.setHeader(w.Header(), "Access-Control-Allow-Origin", allowOrigin)
+	} else if c.debug != nil {
+		c.debugf("cors: %s %s: origin %q rejected, no configured origin matches", r.Method, r.URL.Path, origin)
+	}
+
+	return allowOrigin
+}
+
+// methodsFor returns the methods allowed for the origin of the request,
+// see WithOriginMethods.
+func (c *config) methodsFor(r *http.Request, allowOrigin string) string {
+	if len(c.originMethods) == 0 || allowOrigin == "" {
+		return c.allowedMethods
+	}
+	if methods, ok := c.originMethods[normalizeOrigin(r.Header.Get("Origin"))]; ok {
+		return methods
+	}
+
+	return c.allowedMethods
+}
+
+// applyAllowed sets the headers shared by all responses.
+func (c *config) applyAllowed(w http.ResponseWriter, methods, headers string) {
+	if methods != "" {
+		c.setHeader(w.Header(), "Access-Control-Allow-Methods", methods)
+	}
+	if headers != "" {
+		c.setHeader(w.Header(), "Access-Control-Allow-Headers", headers)
+	}
+	if c.credentials {
+		c.setHeader(w.Header(), "Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// writePreflightStatus answers a preflight request with the configured
+// status and an empty body.
+func (c *config) writePreflightStatus(w http.ResponseWriter) {
+	status := c.preflightStatus
+	if status == 0 {
+		status = http.StatusNoContent
+	}
+	if !c.omitContentLength {
+		c.setHeader(w.Header(), "Content-Length", "0")
+	}
+	w.WriteHeader(status)
+}
+
+// deferringWriter is used when configured with WithDeferToExisting. The
+// CORS headers are collected in pending and only merged into the headers of
+// the response when it is written, leaving the headers that are already set
+// untouched.
+type deferringWriter struct {
+	http.ResponseWriter
+	pending http.Header
+	applied bool
+	merged  bool
+}
+
+// Header returns the pending CORS headers while they are being applied and
+// the headers of the response afterwards.
+func (w *deferringWriter) Header() http.Header {
+	if !w.applied {
+		return w.pending
+	}
+
+	return w.ResponseWriter.Header()
+}
+
+func (w *deferringWriter) WriteHeader(code int) {
+	w.merge()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *deferringWriter) Write(b []byte) (int, error) {
+	w.merge()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher if the underlying ResponseWriter does.
+func (w *deferringWriter) Flush() {
+	w.merge()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the underlying ResponseWriter does,
+// allowing WebSocket upgrades. The pending headers are merged first.
+func (w *deferringWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.merge()
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+
+	return nil, nil, errors.New("cors: the ResponseWriter doesn't support hijacking")
+}
+
+// Unwrap returns the underlying ResponseWriter, for use by
+// http.ResponseController.
+func (w *deferringWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// merge sets the pending headers that aren't already set on the response,
+// adding to the Vary header rather than replacing it.
+func (w *deferringWriter) merge() {
+	w.applied = true
+	if w.merged {
+		return
+	}
+	w.merged = true
+
+	h := w.ResponseWriter.Header()
+	for k, v := range w.pending {
+		if k == "Vary" {
+			for _, value := range v {
+				addVary(h, value)
+			}
+			continue
+		}
+		if len(h[k]) == 0 {
+			h[k] = v
+		}
+	}
+}
+
+// log passes the decision made for the request to the configured loggers
+// and metrics.
+func (c *config) log(r *http.Request, decision string) {
+	if c.logger != nil {
+		c.logger(r, decision)
+	}
+	if c.slogger != nil {
+		c.slogger(r, decision)
+	}
+	if c.metrics != nil {
+		c.metrics(decision)
+	}
+}
+
+// prepare builds the header values that don't depend on the request, like
+// the max age to output, so they can be set on each response without
+// allocating. It must be called whenever the configuration has been
+// changed.
+func (c *config) prepare() {
+	c.maxAgeHeader = c.maxAge
+	if n, err := strconv.Atoi(c.maxAge); err == nil && c.capMaxAge && n > maxBrowserMaxAge {
+		c.maxAgeHeader = strconv.Itoa(maxBrowserMaxAge)
+		c.debugf("cors: max age of %d seconds capped to %d seconds", n, maxBrowserMaxAge)
+	}
+
+	c.values = map[string][]string{}
+	for _, v := range []string{
+		"*", "true", "0", "Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers",
+		c.allowedMethods, c.allowedHeaders, c.maxAgeHeader, c.exposedHeaders,
+	} {
+		c.values[v] = []string{v}
+	}
+	for _, v := range c.originMethods {
+		c.values[v] = []string{v}
+	}
+	for _, v := range c.vary {
+		c.values[v] = []string{v}
+	}
+}
+
+// setHeader sets the header to the value like http.Header.Set does, using
+// the value prepared by prepare if there is one. The prepared values are
+// shared by all responses and their capacity is that of their length, so
+// appending to them copies and they must otherwise not be modified.
+func (c *config) setHeader(h http.Header, key, value string) {
+	if v, ok := c.values[value]; ok {
+		h[key] = v
+		return
+	}
+
+	h.Set(key, value)
+}
+
+// addVary works like the package-level addVary function, but sets the
+// value prepared by prepare when the response has no Vary header yet.
+func (c *config) addVary(h http.Header, value string) {
+	if len(h["Vary"]) == 0 {
+		c.setHeader(h, "Vary", value)
+		return
+	}
+
+	addVary(h, value)
+}
+
+// debugf logs using the logger given with WithDebugLogger, if any. Callers
+// check c.debug first on the request path to avoid building the arguments.
+func (c *config) debugf(format string, v ...interface{}) {
+	if c.debug != nil {
+		c.debug.Printf(format, v...)
+	}
+}
+
+// debugHeaders logs the CORS headers set on the response.
+func (c *config) debugHeaders(w http.ResponseWriter, r *http.Request) {
+	if c.debug == nil {
+		return
+	}
+
+	var emitted []string
+	for _, k := range []string{
+		"Access-Control-Allow-Origin",
+		"Access-Control-Allow-Methods",
+		"Access-Control-Allow-Headers",
+		"Access-Control-Allow-Credentials",
+		"Access-Control-Allow-Private-Network",
+		"Access-Control-Max-Age",
+		"Access-Control-Expose-Headers",
+		"Timing-Allow-Origin",
+		"Vary",
+	} {
+		if v := w.Header().Values(k); len(v) > 0 {
+			emitted = append(emitted, k+": "+strings.Join(v, ", "))
+		}
+	}
+	c.debugf("cors: %s %s: emitted headers %q", r.Method, r.URL.Path, emitted)
+}
+
+// ipOrigin reports whether the host of the origin is an IP address.
+func ipOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && net.ParseIP(u.Hostname()) != nil
+}
+
+// allowedOrigin returns the value of the Access-Control-Allow-Origin header
+// for a request from the given origin, or "" if the origin isn't accepted.
+func (c *config) allowedOrigin(origin string) string {
+	if c.httpsOnly && len(origin) >= len("http://") && strings.EqualFold(origin[:len("http://")], "http://") {
+		return ""
+	}
+	if c.rejectIPs && ipOrigin(origin) {
+		return ""
+	}
+
+	switch {
+	case c.originValidator != nil:
+		if origin != "" && c.originValidator(origin) {
+			return origin
+		}
+	case origin == "null" && (c.allowNull || c.credentials || !c.allowAllOrigins):
+		if c.allowNull || containsString(c.allowedOrigins, "null") {
+			return "null"
+		}
+	case c.allowAllOrigins && c.credentials:
+		return origin
+	case c.allowAllOrigins:
+		return "*"
+	case c.allowsOrigin(origin):
+		return origin
+	}
+
+	return ""
+}
+
+// Middleware returns the Cors as a function that wraps a http.Handler, the
+// signature expected by most routers and middleware chains.
+func (c *Cors) Middleware() func(http.Handler) http.Handler {
+	return c.Wrap
+}
+
+// Handler returns the middleware of c, like c.Middleware, following the
+// naming used by routers like chi:
+//
+//	r := chi.NewRouter()
+//	r.Use(cors.Handler(c))
+func Handler(c *Cors) func(http.Handler) http.Handler {
+	return c.Middleware()
+}
+
+// CheckOrigin reports whether the origin of r is accepted by the Cors,
+// using the same matching as for CORS requests. Requests without an Origin
+// header, which aren't sent by browsers, and same-origin requests are
+// accepted. It can be used as the CheckOrigin function of a WebSocket
+// upgrader, as WebSocket handshakes aren't covered by CORS:
+//
+//	upgrader := websocket.Upgrader{CheckOrigin: c.CheckOrigin}
+func (c *Cors) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || sameOrigin(r) {
+		return true
 	}
 
-	return c
+	cfg := c.requestConfig(r)
+	return cfg.allowedOrigin(origin) != ""
 }
 
-func (c *Cors) Wrap(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if c.allowedOrigins != "" {
-			w.Header().Add("Access-Control-Allow-Origin", c.allowedOrigins)
+// IsPreflight reports whether r is a CORS preflight request: an OPTIONS
+// request with both an Origin and an Access-Control-Request-Method header.
+func IsPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// InjectOptions returns a handler that answers the preflight requests for
+// the routes registered with mux with the preflight response of c, like
+// ApplyPreflight, and passes every other request on to mux. A preflight
+// request is answered if mux has a handler for its path and the requested
+// method, and, if patterns are given, its path also matches one of them
+// the way ServeMux matches patterns. Requests for paths without a route get
+// the response of mux, usually 404 Not Found.
+//
+// Handlers registered with a ServeMux can't be replaced, so the returned
+// handler must be served in place of mux:
+//
+//	http.ListenAndServe(":8080", cors.InjectOptions(mux, c))
+func InjectOptions(mux *http.ServeMux, c *Cors, patterns ...string) http.Handler {
+	var only *http.ServeMux
+	if len(patterns) > 0 {
+		only = http.NewServeMux()
+		for _, p := range patterns {
+			only.Handle(p, http.NotFoundHandler())
 		}
-		if c.allowedMethods != "" {
-			w.Header().Add("Access-Control-Allow-Methods", c.allowedMethods)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsPreflight(r) || (only != nil && !hasRoute(only, r, "")) || !hasRoute(mux, r, r.Header.Get("Access-Control-Request-Method")) {
+			mux.ServeHTTP(w, r)
+			return
 		}
-		if c.allowedHeaders != "" {
-			w.Header().Add("Access-Control-Allow-Headers", c.allowedHeaders)
+		c.ApplyPreflight(w, r)
+	})
+}
+
+// hasRoute reports whether mux has a handler for the path of r and the
+// given method, or the method of r if method is "".
+func hasRoute(mux *http.ServeMux, r *http.Request, method string) bool {
+	if method != "" {
+		r = r.Clone(r.Context())
+		r.Method = method
+	}
+	_, pattern := mux.Handler(r)
+	return pattern != ""
+}
+
+// origins returns the configured origins separated by commas.
+func (c *config) origins() string {
+	if c.allowAllOrigins {
+		return "*"
+	}
+
+	return strings.Join(c.allowedOrigins, ", ")
+}
+
+// timingOrigin returns the value of the Timing-Allow-Origin header for a
+// request from the given origin, or "" if it shouldn't be sent.
+func (c *config) timingOrigin(origin string) string {
+	if c.timingAll {
+		return "*"
+	}
+	if origin == "" || len(c.timingOrigins) == 0 {
+		return ""
+	}
+
+	if c.matchOrigins(c.timingOrigins, origin) {
+		return origin
+	}
+
+	return ""
+}
+
+// variesByOrigin reports whether the CORS headers, like
+// Access-Control-Allow-Origin or the methods given with WithOriginMethods,
+// depend on the origin of the request.
+func (c *config) variesByOrigin() bool {
+	if len(c.timingOrigins) > 0 || len(c.originMethods) > 0 {
+		return true
+	}
+	if c.allowAllOrigins {
+		return c.credentials || c.allowNull || c.originValidator != nil || c.httpsOnly || c.rejectIPs
+	}
+
+	return c.originValidator != nil || len(c.allowedOrigins) > 0 || len(c.originPatterns) > 0
+}
+
+// listContains reports whether value is one of the values in the comma
+// separated list.
+func listContains(list, value string) bool {
+	for _, v := range strings.Split(list, ",") {
+		if strings.TrimSpace(v) == value {
+			return true
 		}
+	}
+
+	return false
+}
 
-		if r != nil && r.Method == http.MethodOptions {
-			if c.maxAge != "" {
-				w.Header().Add("Access-Control-Max-Age", c.maxAge)
+// addVary appends value to the Vary header unless it is already listed,
+// preserving any values that are already present.
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" || strings.EqualFold(field, value) {
+				return
 			}
-			w.WriteHeader(http.StatusNoContent)
-			return
 		}
+	}
 
-		h.ServeHTTP(w, r)
-	})
+	h.Add("Vary", value)
+}
+
+// allowsOrigin reports whether the given origin is accepted. The origins
+// given with WithOrigins are checked first, comparing normalized origins,
+// and then the patterns given with WithOriginPatterns.
+func (c *config) allowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+
+	if c.matchOrigins(c.allowedOrigins, origin) {
+		return true
+	}
+
+	for _, p := range c.originPatterns {
+		if p.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchOrigins reports whether the origin of a request matches any of the
+// given normalized origins, ignoring ports if configured with
+// WithPortAgnosticOrigins.
+func (c *config) matchOrigins(origins []string, origin string) bool {
+	normalized := normalizeOrigin(origin)
+	if c.portAgnostic {
+		normalized = stripPort(normalized)
+	}
+
+	for _, o := range origins {
+		if c.portAgnostic {
+			o = stripPort(o)
+		}
+		if matchOrigin(o, normalized) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stripPort returns the origin without the port of the host, if any.
+func stripPort(origin string) string {
+	i := strings.Index(origin, "://")
+	if i < 0 {
+		return origin
+	}
+
+	host, _, err := net.SplitHostPort(origin[i+len("://"):])
+	if err != nil {
+		return origin
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	return origin[:i+len("://")] + host
+}
+
+// matchOrigin reports whether origin matches the configured pattern. A
+// pattern is either an exact origin, an origin where the left-most label of
+// the host is "*" (e.g. "https://*.example.com") or a domain without scheme
+// starting with "*." (e.g. "*.example.com").
+//
+// An origin with a "*" label matches a single, non-empty label - it never
+// matches across dots - while the scheme, the rest of the host and the port
+// must match exactly. A domain pattern matches the domain itself and any of
+// its subdomains using any scheme.
+func matchOrigin(pattern, origin string) bool {
+	if strings.HasPrefix(pattern, "*.") {
+		i := strings.Index(origin, "://")
+		if i < 0 {
+			return false
+		}
+		host := origin[i+len("://"):]
+		return host == pattern[len("*."):] ||
+			(len(host) > len(pattern)-1 && strings.HasSuffix(host, pattern[len("*"):]))
+	}
+
+	i := strings.Index(pattern, "://*.")
+	if i < 0 {
+		return pattern == origin
+	}
+
+	prefix := pattern[:i+len("://")]
+	suffix := pattern[i+len("://*"):]
+	if len(origin) <= len(prefix)+len(suffix) ||
+		!strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+
+	label := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.ContainsAny(label, ".:/")
+}
+
+// normalizeOrigin returns the origin with the scheme and host in lower case,
+// without the port if it is the default port of the scheme and without any
+// path, like a trailing slash. Values that can't be parsed as an origin,
+// like "null", are returned unchanged.
+func normalizeOrigin(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return s
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	return scheme + "://" + host
+}
+
+// wellFormedOrigin reports whether the configured origin is a scheme and
+// host, with an optional port and trailing slash, and nothing else. Domain
+// patterns like "*.example.com" and the "null" origin are also well-formed.
+func wellFormedOrigin(o string) bool {
+	if strings.HasPrefix(o, "*.") || o == "null" {
+		return true
+	}
+
+	u, err := url.Parse(o)
+	return err == nil && u.Scheme != "" && u.Host != "" && u.User == nil &&
+		(u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.Fragment == "" && !u.ForceQuery
+}
+
+// validOrigin reports whether a configured origin uses the "*" wildcard in
+// one of the supported ways, see matchOrigin.
+func validOrigin(pattern string) bool {
+	rest := pattern
+	if i := strings.Index(pattern, "://"); i >= 0 {
+		rest = pattern[i+len("://"):]
+	}
+	if strings.HasPrefix(rest, "*.") {
+		rest = rest[len("*."):]
+		if rest == "" {
+			return false
+		}
+	}
+
+	return !strings.Contains(rest, "*")
 }
 
 // WithOrigins returns a ConfigFunc that configures the Cors to output a
 // header that signals that only requests from the given hosts are accepted.
+// The origin of each request is matched against the given origins and only
+// the matching origin is sent back. An origin can use "*" as the left-most
+// label of the host to accept any single subdomain, e.g.
+// "https://*.example.com", and a domain starting with "*." accepts the
+// domain and all of its subdomains, e.g. "*.example.com". If any of the
+// origins is "*" all origins are accepted and the other origins are ignored.
+// Origins are compared case-insensitively and ignoring default ports, so
+// "HTTPS://Example.com:443" matches "https://example.com". WithOrigins
+// panics if an origin uses the "*" wildcard in any other way, other
+// malformed origins are reported by Validate.
 func WithOrigins(origins ...string) ConfigFunc {
 	return func(c *Cors) {
-		c.allowedOrigins = strings.Join(origins, ", ")
+		var errs []error
+		c.allowAllOrigins, c.allowedOrigins, errs = parseOrigins(origins)
+		c.errs = append(c.errs, errs...)
+	}
+}
+
+// WithAllowNullOrigin returns a ConfigFunc that configures whether the
+// Cors accepts requests with the origin "null", sending "null" back rather
+// than "*", alongside the other configured origins. Browsers send it for
+// requests from local files, sandboxed iframes and after some cross-origin
+// redirects, so any site can produce it by sandboxing its own content:
+// accepting it is close to accepting every origin and should never be
+// combined with credentials. Without it the "null" origin only matches when
+// given explicitly with WithOrigins or accepted by the function given with
+// WithOriginValidator, and a wildcard origin answers it with "*" only when
+// credentials aren't allowed.
+func WithAllowNullOrigin(allow bool) ConfigFunc {
+	return func(c *Cors) {
+		c.allowNull = allow
+	}
+}
+
+// WithHTTPSOnly returns a ConfigFunc that configures whether the Cors
+// rejects requests from origins using the http scheme, regardless of the
+// configured origins. Cookies marked Secure aren't sent to such origins, so
+// accepting them in production is most likely a mistake. Validate reports
+// any http origin given with WithOrigins when enforced.
+func WithHTTPSOnly(enforce bool) ConfigFunc {
+	return func(c *Cors) {
+		c.httpsOnly = enforce
+	}
+}
+
+// WithRejectIPOrigins returns a ConfigFunc that configures whether the
+// Cors rejects requests from origins where the host is an IP address, like
+// "http://192.168.1.5" or "http://[::1]:8080", regardless of the configured
+// origins. Such origins are rarely intended and usually come from
+// misconfigured clients.
+func WithRejectIPOrigins(reject bool) ConfigFunc {
+	return func(c *Cors) {
+		c.rejectIPs = reject
+	}
+}
+
+// WithPortAgnosticOrigins returns a ConfigFunc that configures the Cors to
+// ignore the port when matching the origin of a request against the origins
+// given with WithOrigins, comparing only the scheme and the host. The origin
+// of the request is still sent back including its port. This is meant for
+// development servers that change port, e.g. accepting
+// "http://localhost:5173" when "http://localhost:3000" is configured.
+func WithPortAgnosticOrigins() ConfigFunc {
+	return func(c *Cors) {
+		c.portAgnostic = true
+	}
+}
+
+// WithOriginsFromEnv returns a ConfigFunc that configures the Cors like
+// WithOrigins with the origins listed in the named environment variable,
+// separated by commas or spaces. The variable is read when the ConfigFunc is
+// applied, so an empty or unset variable accepts no origins.
+func WithOriginsFromEnv(varName string) ConfigFunc {
+	return func(c *Cors) {
+		origins := strings.FieldsFunc(os.Getenv(varName), func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})
+		WithOrigins(origins...)(c)
+	}
+}
+
+// parseOrigins returns whether the origins contain "*" and otherwise the
+// origins normalized for matching with matchOrigin without duplicates, in
+// the order given, together with an error for each malformed origin. It
+// panics if an origin uses the "*" wildcard in an unsupported way.
+func parseOrigins(origins []string) (all bool, normalized []string, errs []error) {
+	for _, o := range origins {
+		if o == "*" {
+			return true, nil, nil
+		}
+		if !validOrigin(o) {
+			panic(fmt.Sprintf("cors: invalid wildcard origin %q", o))
+		}
+		if !wellFormedOrigin(o) {
+			errs = append(errs, fmt.Errorf("cors: malformed origin %q", o))
+		}
+		if strings.HasPrefix(o, "*.") {
+			o = strings.ToLower(o)
+		}
+		if o = normalizeOrigin(o); !containsString(normalized, o) {
+			normalized = append(normalized, o)
+		}
+	}
+
+	return false, normalized, errs
+}
+
+// containsString reports whether s is one of the values in list.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithOriginPatterns returns a ConfigFunc that configures the Cors to
+// accept the origins matching any of the given regular expressions. The
+// origin of the request is sent back when accepted. Patterns that fail to
+// compile are reported by Validate.
+func WithOriginPatterns(patterns ...string) ConfigFunc {
+	return func(c *Cors) {
+		c.originPatterns = nil
+		for _, p := range patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				c.errs = append(c.errs, fmt.Errorf("cors: invalid origin pattern %q: %w", p, err))
+				continue
+			}
+			c.originPatterns = append(c.originPatterns, re)
+		}
+	}
+}
+
+// WithOriginRegexp returns a ConfigFunc that configures the Cors to accept
+// the origins matching the given regular expression in addition to any
+// patterns already configured. Like regexp.MustCompile it panics if the
+// pattern can't be compiled.
+func WithOriginRegexp(pattern string) ConfigFunc {
+	re := regexp.MustCompile(pattern)
+	return func(c *Cors) {
+		c.originPatterns = append(c.originPatterns, re)
+	}
+}
+
+// WithOriginFunc is an alias for WithOriginValidator, named like the
+// AllowOriginFunc option of github.com/rs/cors to ease migrating from it.
+func WithOriginFunc(fn func(origin string) bool) ConfigFunc {
+	return WithOriginValidator(fn)
+}
+
+// WithOriginValidator returns a ConfigFunc that configures the Cors to
+// accept the origins for which the given function returns true. The origin
+// of the request is sent back when accepted. When configured the function
+// alone decides and the origins given with WithOrigins and
+// WithOriginPatterns are ignored.
+func WithOriginValidator(fn func(origin string) bool) ConfigFunc {
+	id := identity(fn)
+	return func(c *Cors) {
+		c.originValidator, c.ids.validator = fn, id
 	}
 }
 
 // WithMethods returns a ConfigFunc that configures the Cors to output
 // a header that signals that only requests with one of the given methods
-// are accepted.
+// are accepted. The methods are trimmed and converted to upper case.
 func WithMethods(methods ...string) ConfigFunc {
 	return func(c *Cors) {
-		c.allowedMethods = strings.Join(methods, ", ")
+		c.allowedMethods = joinNormalized(methods, strings.ToUpper)
+	}
+}
+
+// WithOriginMethods returns a ConfigFunc that configures the Cors to
+// output the given methods instead of the ones given with WithMethods for
+// requests from the given origin. The origin is compared case-insensitively
+// and ignoring default ports like in WithOrigins, but wildcards aren't
+// supported. The origin must still be accepted by the configured origins
+// for any CORS headers to be sent.
+func WithOriginMethods(origin string, methods ...string) ConfigFunc {
+	return func(c *Cors) {
+		// The map is shared with the configurations of requests being
+		// handled, so it is copied rather than changed.
+		m := make(map[string]string, len(c.originMethods)+1)
+		for o, methods := range c.originMethods {
+			m[o] = methods
+		}
+		m[normalizeOrigin(origin)] = joinNormalized(methods, strings.ToUpper)
+		c.originMethods = m
+	}
+}
+
+// WithMethodsFunc returns a ConfigFunc that configures the Cors to call fn
+// for every preflight request to get methods that are accepted besides
+// those given with WithMethods or WithOriginMethods, e.g. to accept more
+// methods on some paths. The methods are normalized like in WithMethods.
+func WithMethodsFunc(fn func(r *http.Request) []string) ConfigFunc {
+	id := identity(fn)
+	return func(c *Cors) {
+		c.methodsFunc, c.ids.methods = fn, id
 	}
 }
 
+// WithAllowAllMethods returns a ConfigFunc that configures the Cors to
+// accept any method by outputting "*" as the allowed methods. Browsers
+// take the "*" literally for requests with credentials, so when credentials
+// are allowed the method asked for by a preflight request is sent back
+// instead.
+func WithAllowAllMethods() ConfigFunc {
+	return WithMethods("*")
+}
+
 // WithMaxAge returns a ConfigFunc that configures the Cors to output
 // a header that signals that the CORS information (optained from a
-// request method OPTIONS) could be cached for the given amount of time.
+// request method OPTIONS) could be cached for the given amount of time,
+// rounded down to whole seconds. A negative age outputs -1 which signals
+// that the information must not be cached at all, while an age of zero
+// doesn't output the header.
 func WithMaxAge(age time.Duration) ConfigFunc {
 	return func(c *Cors) {
-		c.maxAge = fmt.Sprint(int(age.Seconds()))
+		switch {
+		case age < 0:
+			c.maxAge = "-1"
+		case age == 0:
+			c.maxAge = ""
+		default:
+			c.maxAge = fmt.Sprint(int(age.Seconds()))
+		}
+	}
+}
+
+// maxBrowserMaxAge is the largest max age in seconds that browsers use.
+// Firefox caches preflight responses for at most 24 hours and Chromium for
+// at most 2 hours.
+const maxBrowserMaxAge = 86400
+
+// WithMaxAgeCap returns a ConfigFunc that configures the Cors to output at
+// most 86400 seconds (24 hours) as the max age, as browsers ignore larger
+// values. Capping is logged with the logger given with WithDebugLogger. The
+// MaxAge method still returns the configured max age.
+func WithMaxAgeCap() ConfigFunc {
+	return func(c *Cors) {
+		c.capMaxAge = true
+	}
+}
+
+// WithMaxAgeSeconds returns a ConfigFunc that configures the Cors like
+// WithMaxAge, but taking the number of seconds as a plain integer as is
+// common in configuration files. Unlike WithMaxAge zero outputs the header
+// with the value 0. Negative values are ignored and reported by Validate.
+func WithMaxAgeSeconds(seconds int) ConfigFunc {
+	return func(c *Cors) {
+		if seconds < 0 {
+			c.errs = append(c.errs, fmt.Errorf("cors: invalid max age %d", seconds))
+			return
+		}
+		c.maxAge = strconv.Itoa(seconds)
 	}
 }
 
 // WithHeaders returns a ConfigFunc that configures the Cors to output
-// a header that signals that only the given headers are accepted.
+// a header that signals that only the given headers are accepted. The
+// headers are trimmed and converted to their canonical form, e.g.
+// "content-type" becomes "Content-Type".
 func WithHeaders(headers ...string) ConfigFunc {
 	return func(c *Cors) {
-		c.allowedHeaders = strings.Join(headers, ", ")
+		c.allowedHeaders = joinNormalized(headers, http.CanonicalHeaderKey)
+	}
+}
+
+// WithHeadersFunc returns a ConfigFunc that configures the Cors to call fn
+// for every preflight request to get headers that are accepted besides
+// those given with WithHeaders, e.g. to accept more headers on some
+// endpoints. The headers are normalized like in WithHeaders.
+func WithHeadersFunc(fn func(r *http.Request) []string) ConfigFunc {
+	id := identity(fn)
+	return func(c *Cors) {
+		c.headersFunc, c.ids.headers = fn, id
+	}
+}
+
+// WithAllowAllHeaders returns a ConfigFunc that configures the Cors to
+// accept any header by outputting "*" as the allowed headers. Browsers
+// take the "*" literally for requests with credentials, so when credentials
+// are allowed the headers asked for by a preflight request are sent back
+// instead, like WithReflectRequestHeaders does.
+func WithAllowAllHeaders() ConfigFunc {
+	return WithHeaders("*")
+}
+
+// joinNormalized trims the values, normalizes them with fn and joins them
+// separated by commas, leaving out empty values.
+func joinNormalized(values []string, fn func(string) string) string {
+	normalized := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			normalized = append(normalized, fn(v))
+		}
+	}
+
+	return strings.Join(normalized, ", ")
+}
+
+// WithAllowAll returns a ConfigFunc that configures the Cors to accept any
+// origin, all the standard methods and any header, and to signal that the
+// CORS information must not be cached. Credentials are disabled as they
+// can't be combined with a wildcard origin. This is meant for development
+// only and applying it logs a warning saying so.
+func WithAllowAll() ConfigFunc {
+	return func(c *Cors) {
+		log.Println("cors: WithAllowAll accepts requests from any origin and is unsafe for production use")
+		c.allowAllOrigins = true
+		c.allowedOrigins = nil
+		c.allowedMethods = "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"
+		c.allowedHeaders = "*"
+		c.maxAge = "0"
+		c.credentials = false
+	}
+}
+
+// WithReflectRequestHeaders returns a ConfigFunc that configures whether
+// the Cors accepts whatever headers a preflight request asks for by sending
+// the Access-Control-Request-Headers header of the request back as the
+// allowed headers. This is the way to accept any header that works in all
+// browsers, also for requests with credentials where a "*" given with
+// WithHeaders is taken literally. The headers given with WithHeaders are
+// used when the request doesn't ask for any headers.
+func WithReflectRequestHeaders(enable bool) ConfigFunc {
+	return func(c *Cors) {
+		c.reflectHeaders = enable
+	}
+}
+
+// WithDefaults returns a ConfigFunc that configures the Cors to accept the
+// methods GET, POST, PUT, PATCH, DELETE and OPTIONS and the headers
+// Content-Type and Authorization, unless methods or headers are already
+// configured. The defaults are opinionated and meant for getting started
+// quickly - a production setup should configure exactly what it needs.
+func WithDefaults() ConfigFunc {
+	return func(c *Cors) {
+		if c.allowedMethods == "" {
+			c.allowedMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+		}
+		if c.allowedHeaders == "" {
+			c.allowedHeaders = "Content-Type, Authorization"
+		}
+	}
+}
+
+// WithExposedHeaders returns a ConfigFunc that configures the Cors to
+// output a header that signals which response headers may be read by the
+// client. The header is not sent on preflight (OPTIONS) responses.
+func WithExposedHeaders(headers ...string) ConfigFunc {
+	return func(c *Cors) {
+		c.exposedHeaders = strings.Join(headers, ", ")
+	}
+}
+
+// WithVary returns a ConfigFunc that configures the Cors to add the given
+// header names to the Vary header of every response, besides the Origin
+// added when the response depends on it. Names already present in the Vary
+// header of the response are not added again.
+func WithVary(headers ...string) ConfigFunc {
+	return func(c *Cors) {
+		for _, h := range headers {
+			if h = http.CanonicalHeaderKey(strings.TrimSpace(h)); h != "" && !containsString(c.vary, h) {
+				c.vary = append(c.vary, h)
+			}
+		}
+	}
+}
+
+// WithTimingAllowOrigin returns a ConfigFunc that configures the Cors to
+// output a Timing-Allow-Origin header, which allows the given origins to
+// read the detailed timing of the response through the Resource Timing API.
+// The origins are matched like in WithOrigins, including "*" to allow any
+// origin. The header is not sent on preflight (OPTIONS) responses.
+func WithTimingAllowOrigin(origins ...string) ConfigFunc {
+	return func(c *Cors) {
+		var errs []error
+		c.timingAll, c.timingOrigins, errs = parseOrigins(origins)
+		c.errs = append(c.errs, errs...)
+	}
+}
+
+// WithRequireOriginHeader returns a ConfigFunc that configures whether the
+// Cors only handles requests with an Origin header, which is the default.
+// Requests without an Origin header are same-origin or not sent by a
+// browser, so they are passed on to the wrapped handler without any CORS
+// headers. When require is false the CORS headers are output, and preflight
+// requests answered, regardless of the Origin header.
+func WithRequireOriginHeader(require bool) ConfigFunc {
+	return func(c *Cors) {
+		c.optionalOrigin = !require
+	}
+}
+
+// WithPreflightStatus returns a ConfigFunc that configures the Cors to
+// answer preflight requests with the given status code instead of the
+// default 204 No Content. Status codes outside the 2xx range are ignored and
+// reported by Validate.
+func WithPreflightStatus(code int) ConfigFunc {
+	return func(c *Cors) {
+		if code < 200 || code > 299 {
+			c.errs = append(c.errs, fmt.Errorf("cors: invalid preflight status %d", code))
+			return
+		}
+		c.preflightStatus = code
+	}
+}
+
+// WithExplicitContentLength returns a ConfigFunc that configures whether
+// the Cors sends a Content-Length: 0 header when answering preflight
+// requests, which is the default. Some strict clients and proxies expect it
+// even on 204 No Content responses. It has no effect on 204 responses sent
+// by the net/http server, which removes the header from them. The server
+// also adds the header to other empty responses by itself, so there it
+// only matters for responses flushed before the handler returns, e.g. by a
+// wrapping middleware. Other servers and ResponseWriters get the header
+// as set.
+func WithExplicitContentLength(emit bool) ConfigFunc {
+	return func(c *Cors) {
+		c.omitContentLength = !emit
+	}
+}
+
+// WithPrivateNetwork returns a ConfigFunc that configures the Cors to
+// output a header that signals that requests to a server on a private
+// network are accepted (Private Network Access). The header is only sent on
+// preflight requests asking for it with the
+// Access-Control-Request-Private-Network header.
+func WithPrivateNetwork(allow bool) ConfigFunc {
+	return func(c *Cors) {
+		c.privateNetwork = allow
+	}
+}
+
+// WithAllowPrivateNetwork is short for WithPrivateNetwork(true).
+func WithAllowPrivateNetwork() ConfigFunc {
+	return WithPrivateNetwork(true)
+}
+
+// WithPreflightPassthrough returns a ConfigFunc that configures whether the
+// Cors calls the wrapped handler for preflight requests instead of answering
+// them with 204 No Content, letting the handler write its own response. The
+// CORS headers are set before the handler is called.
+func WithPreflightPassthrough(passthrough bool) ConfigFunc {
+	return func(c *Cors) {
+		c.passthrough = passthrough
+	}
+}
+
+// WithOptionsPassthrough is short for WithPreflightPassthrough(true).
+func WithOptionsPassthrough() ConfigFunc {
+	return WithPreflightPassthrough(true)
+}
+
+// WithLogger returns a ConfigFunc that configures the Cors to call fn with
+// every request and the decision made for it: "allowed" or "rejected"
+// depending on the origin, "preflight" for an answered preflight request
+// from an accepted origin or "no-origin" for a request without an Origin
+// header. The function is called after the request has been handled, also
+// when the wrapped handler panics. A nil fn disables logging.
+func WithLogger(fn func(r *http.Request, decision string)) ConfigFunc {
+	id := identity(fn)
+	return func(c *Cors) {
+		c.logger, c.ids.logger = fn, id
+	}
+}
+
+// WithRejectionHandler returns a ConfigFunc that configures the Cors to
+// call fn instead of the wrapped handler for requests from an origin that
+// isn't accepted, including preflight requests. This allows answering with
+// a custom error or counting rejections. Without a rejection handler - or
+// with a nil fn - such requests are passed on without any CORS headers,
+// leaving it to the browser to block the response.
+func WithRejectionHandler(fn func(w http.ResponseWriter, r *http.Request)) ConfigFunc {
+	id := identity(fn)
+	return func(c *Cors) {
+		c.rejected, c.ids.rejected = fn, id
+	}
+}
+
+// WithStrictOrigin returns a ConfigFunc that configures the Cors to answer
+// requests from an origin that isn't accepted with 403 Forbidden instead of
+// calling the wrapped handler, for any method. Requests without an Origin
+// header and requests whose origin is the host they were sent to are
+// passed on as usual. A rejection handler given with WithRejectionHandler
+// is used instead of the 403 response.
+func WithStrictOrigin() ConfigFunc {
+	return func(c *Cors) {
+		c.strict = true
+	}
+}
+
+// WithDeferToExisting returns a ConfigFunc that configures the Cors to
+// leave the CORS headers already set on the response alone, both by earlier
+// middleware and by the wrapped handler, only setting those that are
+// missing when the response is written. This allows a few handlers to
+// decide their own CORS headers. It applies to Wrap and ServeHTTP, not to
+// Apply and friends where the caller controls the response. The wrapped
+// handler must write the response through the ResponseWriter it is given,
+// which the echocors and gincors adapters take care of.
+func WithDeferToExisting() ConfigFunc {
+	return func(c *Cors) {
+		c.deferExisting = true
+	}
+}
+
+// Logger is the interface of the logger given with WithDebugLogger. It is
+// implemented by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithDebugLogger returns a ConfigFunc that configures the Cors to log
+// while handling a request: the origin seen and whether it was accepted,
+// why a preflight request was allowed or denied and the CORS headers that
+// were set. This is meant for tracking down why CORS requests fail and is
+// too verbose for regular use. A nil logger disables the logging.
+func WithDebugLogger(l Logger) ConfigFunc {
+	if ll, ok := l.(*log.Logger); ok && ll == nil {
+		l = nil
+	}
+
+	return func(c *Cors) {
+		c.debug = l
+	}
+}
+
+// WithCredentials returns a ConfigFunc that configures the Cors to output
+// a header that signals that requests including credentials (cookies or
+// HTTP authentication) are accepted. Browsers reject credentials combined
+// with a wildcard origin, so when all origins are accepted the origin of the
+// request is sent back instead of "*". Validate still reports the
+// combination as it accepts credentials from any origin.
+func WithCredentials(allow bool) ConfigFunc {
+	return func(c *Cors) {
+		c.credentials = allow
 	}
 }
@@ -1,9 +1,17 @@
 package cors
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -20,16 +28,30 @@ func TestOrigin(t *testing.T) {
 	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 	wrapped := New(WithOrigins("Foo")).Wrap(emptyHandler)
 	recorder := httptest.NewRecorder()
-	wrapped.ServeHTTP(recorder, nil)
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
 	validateHeaders("Foo", "", "", "", recorder, t)
 }
 
 func TestOrigins(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("Foo", "Bar")).Wrap(emptyHandler)
+	for _, origin := range []string{"Foo", "Bar"} {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, origin, t))
+		validateHeaders(origin, "", "", "", recorder, t)
+	}
+}
+
+func TestOriginNotAllowed(t *testing.T) {
 	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 	wrapped := New(WithOrigins("Foo", "Bar")).Wrap(emptyHandler)
 	recorder := httptest.NewRecorder()
-	wrapped.ServeHTTP(recorder, nil)
-	validateHeaders("Foo, Bar", "", "", "", recorder, t)
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Baz", t))
+	validateHeaders("", "", "", "", recorder, t)
+
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "", t))
+	validateHeaders("", "", "", "", recorder, t)
 }
 
 func TestMethod(t *testing.T) {
@@ -37,7 +59,7 @@ func TestMethod(t *testing.T) {
 	corsMw := New(WithMethods(http.MethodPut))
 	wrapped := corsMw.Wrap(emptyHandler)
 	recorder := httptest.NewRecorder()
-	wrapped.ServeHTTP(recorder, nil)
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
 	validateHeaders("", http.MethodPut, "", "", recorder, t)
 }
 
@@ -46,7 +68,7 @@ func TestMethods(t *testing.T) {
 	corsMw := New(WithMethods(http.MethodDelete, http.MethodPost))
 	wrapped := corsMw.Wrap(emptyHandler)
 	recorder := httptest.NewRecorder()
-	wrapped.ServeHTTP(recorder, nil)
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
 	validateHeaders("", fmt.Sprintf("%s, %s", http.MethodDelete, http.MethodPost), "", "", recorder, t)
 }
 
@@ -55,7 +77,7 @@ func TestHeader(t *testing.T) {
 	corsMw := New(WithHeaders("X-Foo"))
 	wrapped := corsMw.Wrap(emptyHandler)
 	recorder := httptest.NewRecorder()
-	wrapped.ServeHTTP(recorder, nil)
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
 	validateHeaders("", "", "X-Foo", "", recorder, t)
 }
 
@@ -64,7 +86,7 @@ func TestHeaders(t *testing.T) {
 	corsMw := New(WithHeaders("X-Foo", "X-Bar"))
 	wrapped := corsMw.Wrap(emptyHandler)
 	recorder := httptest.NewRecorder()
-	wrapped.ServeHTTP(recorder, nil)
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
 	validateHeaders("", "", "X-Foo, X-Bar", "", recorder, t)
 }
 
@@ -73,21 +95,43 @@ func TestAge(t *testing.T) {
 	corsMw := New(WithMaxAge(time.Hour))
 	wrapped := corsMw.Wrap(emptyHandler)
 	recorder := httptest.NewRecorder()
-	req, err := http.NewRequest(http.MethodOptions, "", nil)
+	wrapped.ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodGet, t))
+	validateHeaders("", "", "", fmt.Sprint(time.Hour.Seconds()), recorder, t)
+}
+
+func newRequest(method, origin string, t *testing.T) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest(method, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	wrapped.ServeHTTP(recorder, req)
-	validateHeaders("", "", "", fmt.Sprint(time.Hour.Seconds()), recorder, t)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+
+	return req
+}
+
+func newPreflightRequest(origin, method string, t *testing.T) *http.Request {
+	t.Helper()
+
+	req := newRequest(http.MethodOptions, origin, t)
+	req.Header.Set("Access-Control-Request-Method", method)
+
+	return req
 }
 
 func validateHeaders(originVal, methodsVal, headersVal, ageVal string, recorder *httptest.ResponseRecorder, t *testing.T) {
 	t.Helper()
 
-	originHeader := recorder.Header().Get("Access-Control-Allow-Origin")
-	methodsHeader := recorder.Header().Get("Access-Control-Allow-Methods")
-	headersHeader := recorder.Header().Get("Access-Control-Allow-Headers")
-	ageHeader := recorder.Header().Get("Access-Control-Max-Age")
+	// The headers of the result are those sent when the response was
+	// written, unlike recorder.Header() which includes later changes.
+	header := recorder.Result().Header
+	originHeader := header.Get("Access-Control-Allow-Origin")
+	methodsHeader := header.Get("Access-Control-Allow-Methods")
+	headersHeader := header.Get("Access-Control-Allow-Headers")
+	ageHeader := header.Get("Access-Control-Max-Age")
 
 	if originHeader != originVal {
 		t.Fatal("unexpected header for \"Access-Control-Allow-Origin\":", originHeader)
@@ -105,3 +149,2635 @@ func validateHeaders(originVal, methodsVal, headersVal, ageVal string, recorder
 		t.Fatal("unexpected header for \"Access-Control-Max-Age\":", ageHeader)
 	}
 }
+
+func TestCredentials(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	corsMw := New(WithCredentials(true))
+	wrapped := corsMw.Wrap(emptyHandler)
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	if val := recorder.Header().Get("Access-Control-Allow-Credentials"); val != "true" {
+		t.Fatal("unexpected header for \"Access-Control-Allow-Credentials\":", val)
+	}
+
+	corsMw = New(WithCredentials(false))
+	wrapped = corsMw.Wrap(emptyHandler)
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	if val := recorder.Header().Get("Access-Control-Allow-Credentials"); val != "" {
+		t.Fatal("unexpected header for \"Access-Control-Allow-Credentials\":", val)
+	}
+}
+
+func TestValidateCredentialsWildcard(t *testing.T) {
+	if err := New(WithOrigins("*"), WithCredentials(true)).Validate(); err == nil {
+		t.Fatal("expected error for wildcard origin with credentials")
+	}
+
+	if err := New(WithOrigins("https://example.com"), WithCredentials(true)).Validate(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestExposedHeaders(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	corsMw := New(WithExposedHeaders("X-Request-Id", "X-RateLimit-Remaining"))
+	wrapped := corsMw.Wrap(emptyHandler)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(method, "Foo", t))
+		if val := recorder.Header().Get("Access-Control-Expose-Headers"); val != "X-Request-Id, X-RateLimit-Remaining" {
+			t.Fatal("unexpected header for \"Access-Control-Expose-Headers\":", val)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodGet, t))
+	if val := recorder.Header().Get("Access-Control-Expose-Headers"); val != "" {
+		t.Fatal("unexpected header for \"Access-Control-Expose-Headers\":", val)
+	}
+}
+
+func TestWildcardOrigin(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("*")).Wrap(emptyHandler)
+	for _, origin := range []string{"Foo", "Bar"} {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, origin, t))
+		validateHeaders("*", "", "", "", recorder, t)
+	}
+}
+
+func TestWildcardOriginMixed(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("Foo", "*", "Bar")).Wrap(emptyHandler)
+	for _, origin := range []string{"Foo", "Baz"} {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, origin, t))
+		validateHeaders("*", "", "", "", recorder, t)
+	}
+}
+
+func TestSubdomainWildcardOrigin(t *testing.T) {
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://a.example.com", true},
+		{"https://b.example.com", true},
+		{"https://example.com", false},
+		{"https://.example.com", false},
+		{"https://a.b.example.com", false},
+		{"http://a.example.com", false},
+		{"https://a.example.com:8443", false},
+		{"https://evil.com.attacker.net", false},
+		{"https://a.example.com.attacker.net", false},
+	}
+
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("https://*.example.com")).Wrap(emptyHandler)
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, test.origin, t))
+		expected := ""
+		if test.allowed {
+			expected = test.origin
+		}
+		if val := recorder.Header().Get("Access-Control-Allow-Origin"); val != expected {
+			t.Fatalf("unexpected header for \"Access-Control-Allow-Origin\" with origin %q: %q", test.origin, val)
+		}
+	}
+}
+
+func TestSubdomainWildcardOriginPort(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("https://*.example.com:8443")).Wrap(emptyHandler)
+
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "https://a.example.com:8443", t))
+	validateHeaders("https://a.example.com:8443", "", "", "", recorder, t)
+
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "https://a.example.com", t))
+	validateHeaders("", "", "", "", recorder, t)
+}
+
+func TestOriginValidator(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	validator := func(origin string) bool {
+		return origin == "https://tenant.example.com"
+	}
+	wrapped := New(WithOrigins("https://static.example.com"), WithOriginValidator(validator)).Wrap(emptyHandler)
+
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "https://tenant.example.com", t))
+	validateHeaders("https://tenant.example.com", "", "", "", recorder, t)
+	if val := recorder.Header().Get("Vary"); val != "Origin" {
+		t.Fatal("unexpected header for \"Vary\":", val)
+	}
+
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "https://static.example.com", t))
+	validateHeaders("", "", "", "", recorder, t)
+
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "", t))
+	validateHeaders("", "", "", "", recorder, t)
+}
+
+func TestVaryOrigin(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	validator := func(origin string) bool { return false }
+	tests := []struct {
+		cors *Cors
+		vary string
+	}{
+		{New(), ""},
+		{New(WithOrigins("*")), ""},
+		{New(WithOrigins("Foo")), "Origin"},
+		{New(WithOriginValidator(validator)), "Origin"},
+	}
+
+	for _, test := range tests {
+		for _, origin := range []string{"Foo", "Bar"} {
+			recorder := httptest.NewRecorder()
+			test.cors.Wrap(emptyHandler).ServeHTTP(recorder, newRequest(http.MethodGet, origin, t))
+			if val := recorder.Header().Get("Vary"); val != test.vary {
+				t.Fatal("unexpected header for \"Vary\":", val)
+			}
+		}
+	}
+}
+
+func TestOriginPatterns(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	corsMw := New(WithOrigins("https://example.com"), WithOriginPatterns(`^https://v\d+\.preview\.example\.com$`))
+	if err := corsMw.Validate(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	wrapped := corsMw.Wrap(emptyHandler)
+
+	for _, origin := range []string{"https://example.com", "https://v12.preview.example.com"} {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, origin, t))
+		validateHeaders(origin, "", "", "", recorder, t)
+	}
+
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "https://vx.preview.example.com", t))
+	validateHeaders("", "", "", "", recorder, t)
+}
+
+func TestOriginPatternsInvalid(t *testing.T) {
+	if err := New(WithOriginPatterns(`^https://(`)).Validate(); err == nil {
+		t.Fatal("expected error for invalid origin pattern")
+	}
+}
+
+func TestOriginFunc(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	approved := map[string]bool{"https://tenant.example.com": true}
+	corsMw := New(WithOrigins("https://static.example.com"), WithOriginFunc(func(origin string) bool {
+		return approved[origin]
+	}))
+	wrapped := corsMw.Wrap(emptyHandler)
+
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "https://tenant.example.com", t))
+	validateHeaders("https://tenant.example.com", "", "", "", recorder, t)
+
+	// WithOriginFunc is an alias for WithOriginValidator, so the function
+	// alone decides.
+	for _, origin := range []string{"https://static.example.com", "https://other.example.com"} {
+		recorder = httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, origin, t))
+		validateHeaders("", "", "", "", recorder, t)
+	}
+
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "https://other.example.com", t))
+	validateHeaders("", "", "", "", recorder, t)
+
+	approved["https://other.example.com"] = true
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "https://other.example.com", t))
+	validateHeaders("https://other.example.com", "", "", "", recorder, t)
+}
+
+func TestDomainWildcardOrigin(t *testing.T) {
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"http://admin.example.com", true},
+		{"https://a.b.example.com", true},
+		{"https://example.com", true},
+		{"https://notexample.com", false},
+		{"https://example.com.attacker.net", false},
+		{"example.com", false},
+	}
+
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("*.example.com")).Wrap(emptyHandler)
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, test.origin, t))
+		expected := ""
+		if test.allowed {
+			expected = test.origin
+		}
+		if val := recorder.Header().Get("Access-Control-Allow-Origin"); val != expected {
+			t.Fatalf("unexpected header for \"Access-Control-Allow-Origin\" with origin %q: %q", test.origin, val)
+		}
+		if val := recorder.Header().Get("Vary"); val != "Origin" {
+			t.Fatal("unexpected header for \"Vary\":", val)
+		}
+	}
+}
+
+func TestInvalidWildcardOrigin(t *testing.T) {
+	for _, origin := range []string{"*foo.example.com", "https://*foo.example.com", "https://a.*.example.com", "*."} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected panic for origin %q", origin)
+				}
+			}()
+			New(WithOrigins(origin))
+		}()
+	}
+}
+
+func TestVaryOriginPreserved(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("Foo")).Wrap(emptyHandler)
+
+	recorder := httptest.NewRecorder()
+	recorder.Header().Set("Vary", "Accept-Encoding")
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	if vals := recorder.Header().Values("Vary"); len(vals) != 2 || vals[0] != "Accept-Encoding" || vals[1] != "Origin" {
+		t.Fatal("unexpected header for \"Vary\":", vals)
+	}
+
+	recorder = httptest.NewRecorder()
+	recorder.Header().Set("Vary", "Accept-Encoding, origin")
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	if vals := recorder.Header().Values("Vary"); len(vals) != 1 || vals[0] != "Accept-Encoding, origin" {
+		t.Fatal("unexpected header for \"Vary\":", vals)
+	}
+}
+
+func TestOriginRegexp(t *testing.T) {
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://pr-1.staging.example.com", true},
+		{"https://pr-1234.staging.example.com", true},
+		{"https://pr-x.staging.example.com", false},
+		{"https://pr-1.staging.example.com.attacker.net", false},
+		{"", false},
+	}
+
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOriginRegexp(`^https://pr-\d+\.staging\.example\.com$`)).Wrap(emptyHandler)
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, test.origin, t))
+		expected := ""
+		if test.allowed {
+			expected = test.origin
+		}
+		if val := recorder.Header().Get("Access-Control-Allow-Origin"); val != expected {
+			t.Fatalf("unexpected header for \"Access-Control-Allow-Origin\" with origin %q: %q", test.origin, val)
+		}
+		if val := recorder.Header().Get("Vary"); val != "Origin" {
+			t.Fatal("unexpected header for \"Vary\":", val)
+		}
+	}
+}
+
+func TestOriginRegexpInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for invalid origin regexp")
+		}
+	}()
+	New(WithOriginRegexp(`^https://(`))
+}
+
+func TestMiddleware(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	corsMw := New(WithOrigins("Foo"), WithMethods(http.MethodPut), WithHeaders("X-Foo"))
+
+	wrappedRecorder := httptest.NewRecorder()
+	corsMw.Wrap(emptyHandler).ServeHTTP(wrappedRecorder, newRequest(http.MethodGet, "Foo", t))
+
+	recorder := httptest.NewRecorder()
+	corsMw.Middleware()(emptyHandler).ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	validateHeaders("Foo", http.MethodPut, "X-Foo", "", recorder, t)
+	validateHeaders(wrappedRecorder.Header().Get("Access-Control-Allow-Origin"),
+		wrappedRecorder.Header().Get("Access-Control-Allow-Methods"),
+		wrappedRecorder.Header().Get("Access-Control-Allow-Headers"),
+		wrappedRecorder.Header().Get("Access-Control-Max-Age"), recorder, t)
+}
+
+func TestCredentialsPreflightAndActual(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("Foo"), WithCredentials(true)).Wrap(emptyHandler)
+
+	for _, req := range []*http.Request{newPreflightRequest("Foo", http.MethodGet, t), newRequest(http.MethodGet, "Foo", t)} {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, req)
+		if val := recorder.Header().Get("Access-Control-Allow-Credentials"); val != "true" {
+			t.Fatalf("unexpected header for \"Access-Control-Allow-Credentials\" on %s: %q", req.Method, val)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	corsMw := New(WithOrigins("Foo"), WithMethods(http.MethodPut), WithMaxAge(time.Hour)).Mount(handler)
+
+	recorder := httptest.NewRecorder()
+	corsMw.ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodPut, t))
+	validateHeaders("Foo", http.MethodPut, "", fmt.Sprint(time.Hour.Seconds()), recorder, t)
+	if recorder.Code != http.StatusNoContent || called {
+		t.Fatal("unexpected preflight response:", recorder.Code, called)
+	}
+
+	recorder = httptest.NewRecorder()
+	corsMw.ServeHTTP(recorder, newRequest(http.MethodPut, "Foo", t))
+	validateHeaders("Foo", http.MethodPut, "", "", recorder, t)
+	if !called {
+		t.Fatal("mounted handler not called")
+	}
+}
+
+func TestServeHTTPWithoutHandler(t *testing.T) {
+	c := New(WithOrigins("Foo"), WithMethods(http.MethodGet, http.MethodPost))
+
+	recorder := httptest.NewRecorder()
+	c.ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatal("unexpected status code:", recorder.Code)
+	}
+	if recorder.Header().Get("Allow") != "GET, POST" {
+		t.Fatal("unexpected Allow header:", recorder.Header().Get("Allow"))
+	}
+
+	recorder = httptest.NewRecorder()
+	c.ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodPost, t))
+	if recorder.Code != http.StatusNoContent {
+		t.Fatal("unexpected status code:", recorder.Code)
+	}
+	validateHeaders("Foo", "GET, POST", "", "", recorder, t)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", c)
+	r := newPreflightRequest("Foo", http.MethodGet, t)
+	r.URL.Path = "/api/items"
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, r)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatal("unexpected status code:", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	New(WithOrigins("Foo")).ServeHTTP(recorder, newRequest(http.MethodPut, "Foo", t))
+	if recorder.Code != http.StatusMethodNotAllowed || recorder.Header().Get("Allow") != http.MethodOptions {
+		t.Fatal("unexpected response:", recorder.Code, recorder.Header().Get("Allow"))
+	}
+
+	recorder = httptest.NewRecorder()
+	New(WithOrigins("Foo"), WithAllowAllMethods()).ServeHTTP(recorder, newRequest(http.MethodPut, "Foo", t))
+	if _, ok := recorder.Header()["Allow"]; recorder.Code != http.StatusMethodNotAllowed || ok {
+		t.Fatal("unexpected response:", recorder.Code, recorder.Header().Get("Allow"))
+	}
+}
+
+func TestCredentialsWildcardOrigin(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("*"), WithCredentials(true)).Wrap(emptyHandler)
+
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	validateHeaders("Foo", "", "", "", recorder, t)
+	if val := recorder.Header().Get("Vary"); val != "Origin" {
+		t.Fatal("unexpected header for \"Vary\":", val)
+	}
+}
+
+func TestWrapFunc(t *testing.T) {
+	called := false
+	wrapped := New(WithOrigins("Foo"), WithHeaders("X-Foo")).WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	validateHeaders("Foo", "", "X-Foo", "", recorder, t)
+	if !called {
+		t.Fatal("wrapped function not called")
+	}
+}
+
+func TestExposedHeadersPagination(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("Foo"), WithExposedHeaders("X-Total-Count", "Location")).Wrap(emptyHandler)
+
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	if val := recorder.Header().Get("Access-Control-Expose-Headers"); val != "X-Total-Count, Location" {
+		t.Fatal("unexpected header for \"Access-Control-Expose-Headers\":", val)
+	}
+
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodGet, t))
+	if recorder.Code != http.StatusNoContent {
+		t.Fatal("unexpected status code:", recorder.Code)
+	}
+	if val := recorder.Header().Get("Access-Control-Expose-Headers"); val != "" {
+		t.Fatal("unexpected header for \"Access-Control-Expose-Headers\":", val)
+	}
+}
+
+func TestNoOrigin(t *testing.T) {
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	wrapped := New(WithOrigins("*"), WithMethods(http.MethodPut), WithHeaders("X-Foo"), WithMaxAge(time.Hour)).Wrap(handler)
+
+	for _, method := range []string{http.MethodGet, http.MethodOptions} {
+		called = false
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(method, "", t))
+		validateHeaders("", "", "", "", recorder, t)
+		if !called {
+			t.Fatalf("handler not called for %s without origin", method)
+		}
+		if recorder.Code != http.StatusOK {
+			t.Fatal("unexpected status code:", recorder.Code)
+		}
+	}
+}
+
+func TestNoOriginVary(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("Foo")).Wrap(emptyHandler)
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "", t))
+	validateHeaders("", "", "", "", recorder, t)
+	if val := recorder.Header().Get("Vary"); val != "Origin" {
+		t.Fatal("unexpected header for \"Vary\":", val)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	recorder := httptest.NewRecorder()
+	New(WithDefaults()).Wrap(emptyHandler).ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	validateHeaders("", "GET, POST, PUT, PATCH, DELETE, OPTIONS", "Content-Type, Authorization", "", recorder, t)
+
+	recorder = httptest.NewRecorder()
+	New(WithMethods(http.MethodGet), WithDefaults()).Wrap(emptyHandler).ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	validateHeaders("", http.MethodGet, "Content-Type, Authorization", "", recorder, t)
+
+	recorder = httptest.NewRecorder()
+	New(WithHeaders("X-Foo"), WithDefaults()).Wrap(emptyHandler).ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	validateHeaders("", "GET, POST, PUT, PATCH, DELETE, OPTIONS", "X-Foo", "", recorder, t)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []ConfigFunc
+		errs    int
+	}{
+		{"valid", []ConfigFunc{WithOrigins("https://a.com", "*.b.com", "https://*.c.com:8443", "null"), WithMethods(http.MethodGet), WithHeaders("X-Foo"), WithMaxAge(time.Hour), WithCredentials(true)}, 0},
+		{"valid validator", []ConfigFunc{WithOriginValidator(func(string) bool { return true })}, 0},
+		{"empty", nil, 1},
+		{"wildcard with credentials", []ConfigFunc{WithOrigins("*"), WithCredentials(true)}, 1},
+		{"malformed origin", []ConfigFunc{WithOrigins("https://a.com/api")}, 1},
+		{"trailing slash", []ConfigFunc{WithOrigins("https://a.com/"), WithMethods(http.MethodGet)}, 0},
+		{"malformed origins", []ConfigFunc{WithOrigins("a.com", "https://a.com/path", "https://a.com?q", "https://user@a.com")}, 4},
+		{"duplicate methods", []ConfigFunc{WithOrigins("*"), WithMethods(http.MethodGet, http.MethodPost, http.MethodGet)}, 1},
+		{"headers without methods", []ConfigFunc{WithOrigins("*"), WithHeaders("X-Foo")}, 1},
+		{"max age without methods or headers", []ConfigFunc{WithOrigins("*"), WithMaxAge(time.Hour)}, 1},
+		{"several", []ConfigFunc{WithOrigins("*"), WithCredentials(true), WithHeaders("X-Foo"), WithOriginPatterns(`(`)}, 3},
+	}
+
+	for _, test := range tests {
+		err := New(test.configs...).Validate()
+		switch {
+		case test.errs == 0 && err != nil:
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		case test.errs == 1 && err == nil:
+			t.Fatalf("%s: expected error", test.name)
+		case test.errs > 1:
+			errs, ok := err.(validationErrors)
+			if !ok || len(errs) != test.errs {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+		}
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	wrapped := New(WithOrigins("Foo"), WithMethods(http.MethodPut), WithMaxAge(time.Hour)).Wrap(handler)
+
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodPut, t))
+	validateHeaders("Foo", http.MethodPut, "", fmt.Sprint(time.Hour.Seconds()), recorder, t)
+	if recorder.Code != http.StatusNoContent || called {
+		t.Fatal("unexpected preflight response:", recorder.Code, called)
+	}
+
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodOptions, "Foo", t))
+	validateHeaders("Foo", http.MethodPut, "", "", recorder, t)
+	if recorder.Code != http.StatusOK || !called {
+		t.Fatal("unexpected OPTIONS response:", recorder.Code, called)
+	}
+}
+
+func TestClone(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	base := New(WithOrigins("Foo"), WithMethods(http.MethodGet), WithOriginRegexp(`^Bar$`))
+	clone := base.Clone(WithOrigins("Baz"), WithMethods(http.MethodPost), WithOriginRegexp(`^Qux$`))
+
+	recorder := httptest.NewRecorder()
+	base.Wrap(emptyHandler).ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	validateHeaders("Foo", http.MethodGet, "", "", recorder, t)
+
+	for _, origin := range []string{"Baz", "Qux"} {
+		recorder = httptest.NewRecorder()
+		base.Wrap(emptyHandler).ServeHTTP(recorder, newRequest(http.MethodGet, origin, t))
+		validateHeaders("", http.MethodGet, "", "", recorder, t)
+
+		recorder = httptest.NewRecorder()
+		clone.Wrap(emptyHandler).ServeHTTP(recorder, newRequest(http.MethodGet, origin, t))
+		validateHeaders(origin, http.MethodPost, "", "", recorder, t)
+	}
+
+	recorder = httptest.NewRecorder()
+	clone.Wrap(emptyHandler).ServeHTTP(recorder, newRequest(http.MethodGet, "Bar", t))
+	validateHeaders("Bar", http.MethodPost, "", "", recorder, t)
+}
+
+func TestPreflightStatus(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	corsMw := New(WithOrigins("*"), WithPreflightStatus(http.StatusOK))
+	if err := corsMw.Validate(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	recorder := httptest.NewRecorder()
+	corsMw.Wrap(emptyHandler).ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodGet, t))
+	if recorder.Code != http.StatusOK {
+		t.Fatal("unexpected status code:", recorder.Code)
+	}
+
+	corsMw = New(WithOrigins("*"), WithPreflightStatus(http.StatusFound))
+	if err := corsMw.Validate(); err == nil {
+		t.Fatal("expected error for invalid preflight status")
+	}
+	recorder = httptest.NewRecorder()
+	corsMw.Wrap(emptyHandler).ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodGet, t))
+	if recorder.Code != http.StatusNoContent {
+		t.Fatal("unexpected status code:", recorder.Code)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	base := New(WithOrigins("Foo"), WithMethods(http.MethodGet), WithHeaders("X-Foo"), WithMaxAge(time.Hour))
+
+	tests := []struct {
+		name                             string
+		overrides                        []*Cors
+		origin, methods, headers, maxAge string
+		rejected                         string
+	}{
+		{"none", nil, "Foo", http.MethodGet, "X-Foo", "3600", "Bar"},
+		{"empty", []*Cors{New()}, "Foo", http.MethodGet, "X-Foo", "3600", "Bar"},
+		{"origins", []*Cors{New(WithOrigins("Bar"))}, "Bar", http.MethodGet, "X-Foo", "3600", "Foo"},
+		{"methods", []*Cors{New(WithMethods(http.MethodPost))}, "Foo", http.MethodPost, "X-Foo", "3600", "Bar"},
+		{"headers", []*Cors{New(WithHeaders("X-Bar"))}, "Foo", http.MethodGet, "X-Bar", "3600", "Bar"},
+		{"max age", []*Cors{New(WithMaxAge(time.Minute))}, "Foo", http.MethodGet, "X-Foo", "60", "Bar"},
+		{"last wins", []*Cors{New(WithMethods(http.MethodPost)), New(WithMethods(http.MethodPut))}, "Foo", http.MethodPut, "X-Foo", "3600", "Bar"},
+	}
+
+	for _, test := range tests {
+		wrapped := Merge(base, test.overrides...).Wrap(emptyHandler)
+
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newPreflightRequest(test.origin, test.methods, t))
+		validateHeaders(test.origin, test.methods, test.headers, test.maxAge, recorder, t)
+
+		recorder = httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, test.rejected, t))
+		if val := recorder.Header().Get("Access-Control-Allow-Origin"); val != "" {
+			t.Fatalf("%s: unexpected header for \"Access-Control-Allow-Origin\": %q", test.name, val)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	base.Wrap(emptyHandler).ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodGet, t))
+	validateHeaders("Foo", http.MethodGet, "X-Foo", "3600", recorder, t)
+}
+
+func TestOptionsPassthrough(t *testing.T) {
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if val := w.Header().Get("Access-Control-Allow-Methods"); val != http.MethodPut {
+			t.Fatal("unexpected header for \"Access-Control-Allow-Methods\":", val)
+		}
+		w.Header().Set("Allow", "OPTIONS, PUT")
+	})
+	wrapped := New(WithOrigins("Foo"), WithMethods(http.MethodPut), WithMaxAge(time.Hour), WithOptionsPassthrough()).Wrap(handler)
+
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodPut, t))
+	validateHeaders("Foo", http.MethodPut, "", "3600", recorder, t)
+	if !called || recorder.Code != http.StatusOK || recorder.Header().Get("Allow") != "OPTIONS, PUT" {
+		t.Fatal("unexpected preflight response:", recorder.Code, called)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	corsMw := New(WithOrigins("Foo"))
+	wrapped := corsMw.Wrap(emptyHandler)
+
+	corsMw.Update(WithOrigins("Bar"), WithMethods(http.MethodPut))
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Bar", t))
+	validateHeaders("Bar", http.MethodPut, "", "", recorder, t)
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	corsMw := New(WithOrigins("Foo"))
+	wrapped := corsMw.Wrap(emptyHandler)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				req, _ := http.NewRequest(http.MethodGet, "", nil)
+				req.Header.Set("Origin", "Foo")
+				wrapped.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		corsMw.Update(WithOrigins("Foo", fmt.Sprint(j)), WithMethods(http.MethodGet), WithMaxAge(time.Duration(j)*time.Second))
+	}
+	wg.Wait()
+}
+
+func TestReflectRequestHeaders(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("Foo"), WithMethods(http.MethodPut), WithHeaders("X-Foo"), WithReflectRequestHeaders(true)).Wrap(emptyHandler)
+
+	req := newPreflightRequest("Foo", http.MethodPut, t)
+	req.Header.Set("Access-Control-Request-Headers", "X-Bar, X-Baz")
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, req)
+	validateHeaders("Foo", http.MethodPut, "X-Bar, X-Baz", "", recorder, t)
+	if vals := recorder.Header().Values("Vary"); len(vals) != 2 || vals[1] != "Access-Control-Request-Headers" {
+		t.Fatal("unexpected header for \"Vary\":", vals)
+	}
+
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodPut, t))
+	validateHeaders("Foo", http.MethodPut, "X-Foo", "", recorder, t)
+
+	req = newRequest(http.MethodPut, "Foo", t)
+	req.Header.Set("Access-Control-Request-Headers", "X-Bar")
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, req)
+	validateHeaders("Foo", http.MethodPut, "X-Foo", "", recorder, t)
+}
+
+func TestGetters(t *testing.T) {
+	corsMw := New(WithOrigins("a", "b"), WithMethods(http.MethodGet, http.MethodPost), WithHeaders("X-Foo"), WithMaxAge(time.Minute))
+	if val := corsMw.AllowedOrigins(); !equalStrings(val, "a", "b") {
+		t.Fatal("unexpected allowed origins:", val)
+	}
+	if val := corsMw.AllowedMethods(); !equalStrings(val, http.MethodGet, http.MethodPost) {
+		t.Fatal("unexpected allowed methods:", val)
+	}
+	if val := corsMw.AllowedHeaders(); !equalStrings(val, "X-Foo") {
+		t.Fatal("unexpected allowed headers:", val)
+	}
+	if val := corsMw.MaxAge(); val != time.Minute {
+		t.Fatal("unexpected max age:", val)
+	}
+
+	if val := New(WithOrigins("a", "*")).AllowedOrigins(); !equalStrings(val, "*") {
+		t.Fatal("unexpected allowed origins:", val)
+	}
+	if val := New(); len(val.AllowedOrigins()) != 0 || len(val.AllowedMethods()) != 0 || len(val.AllowedHeaders()) != 0 || val.MaxAge() != 0 {
+		t.Fatal("unexpected values:", val)
+	}
+	if val := New(WithMaxAge(-time.Second)).MaxAge(); val != -time.Second {
+		t.Fatal("unexpected max age:", val)
+	}
+
+	origins := corsMw.AllowedOrigins()
+	origins[0] = "changed"
+	methods := corsMw.AllowedMethods()
+	methods[0] = "changed"
+	if !equalStrings(corsMw.AllowedOrigins(), "a", "b") || !equalStrings(corsMw.AllowedMethods(), http.MethodGet, http.MethodPost) {
+		t.Fatal("getters returned internal slices")
+	}
+}
+
+// equalStrings reports whether values holds exactly the expected values.
+func equalStrings(values []string, expected ...string) bool {
+	if len(values) != len(expected) {
+		return false
+	}
+	for i := range values {
+		if values[i] != expected[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestPreflightRequestMethod(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("Foo"), WithMethods(http.MethodGet, http.MethodPut)).Wrap(emptyHandler)
+
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodPut, t))
+	validateHeaders("Foo", "GET, PUT", "", "", recorder, t)
+
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodDelete, t))
+	validateHeaders("Foo", "", "", "", recorder, t)
+}
+
+func TestString(t *testing.T) {
+	corsMw := New(WithOrigins("https://a.com", "https://b.com"), WithMethods(http.MethodGet, http.MethodPost), WithHeaders("Content-Type"), WithMaxAge(24*time.Hour), WithCredentials(true), WithExposedHeaders("X-Total"))
+	if val := corsMw.String(); val != `Cors{origins: "https://a.com, https://b.com", methods: "GET, POST", headers: "Content-Type", maxAge: "86400", credentials: true, exposedHeaders: "X-Total"}` {
+		t.Fatal("unexpected string:", val)
+	}
+
+	var zero Cors
+	if val := zero.String(); val != `Cors{origins: "", methods: "", headers: "", maxAge: "", credentials: false, exposedHeaders: ""}` {
+		t.Fatal("unexpected string:", val)
+	}
+	if val := fmt.Sprint(AllowAll()); !strings.HasPrefix(val, `Cors{origins: "*",`) {
+		t.Fatal("unexpected string:", val)
+	}
+}
+
+func TestAllowPrivateNetwork(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		cors     *Cors
+		request  bool
+		expected string
+	}{
+		{New(WithOrigins("Foo"), WithAllowPrivateNetwork()), true, "true"},
+		{New(WithOrigins("Foo"), WithAllowPrivateNetwork()), false, ""},
+		{New(WithOrigins("Foo")), true, ""},
+		{New(WithOrigins("Foo")), false, ""},
+	}
+
+	for _, test := range tests {
+		req := newPreflightRequest("Foo", http.MethodGet, t)
+		if test.request {
+			req.Header.Set("Access-Control-Request-Private-Network", "true")
+		}
+		recorder := httptest.NewRecorder()
+		test.cors.Wrap(emptyHandler).ServeHTTP(recorder, req)
+		if val := recorder.Header().Get("Access-Control-Allow-Private-Network"); val != test.expected {
+			t.Fatal("unexpected header for \"Access-Control-Allow-Private-Network\":", val)
+		}
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	corsMw, err := FromConfig(Config{
+		Origins:        []string{"https://a.com", "https://b.com"},
+		Methods:        []string{http.MethodGet, http.MethodPost},
+		Headers:        []string{"Content-Type"},
+		MaxAgeSecs:     600,
+		Credentials:    true,
+		ExposedHeaders: []string{"X-Total-Count"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	corsMw.Wrap(emptyHandler).ServeHTTP(recorder, newPreflightRequest("https://b.com", http.MethodPost, t))
+	validateHeaders("https://b.com", "GET, POST", "Content-Type", "600", recorder, t)
+	if val := recorder.Header().Get("Access-Control-Allow-Credentials"); val != "true" {
+		t.Fatal("unexpected header for \"Access-Control-Allow-Credentials\":", val)
+	}
+
+	recorder = httptest.NewRecorder()
+	corsMw.Wrap(emptyHandler).ServeHTTP(recorder, newRequest(http.MethodGet, "https://a.com", t))
+	if val := recorder.Header().Get("Access-Control-Expose-Headers"); val != "X-Total-Count" {
+		t.Fatal("unexpected header for \"Access-Control-Expose-Headers\":", val)
+	}
+}
+
+func TestFromConfigInvalid(t *testing.T) {
+	if _, err := FromConfig(Config{Origins: []string{"*"}, Credentials: true}); err == nil {
+		t.Fatal("expected error for wildcard origin with credentials")
+	}
+	if _, err := FromConfig(Config{Origins: []string{"https://*foo.com"}}); err == nil {
+		t.Fatal("expected error for invalid wildcard origin")
+	}
+}
+
+func TestNoDuplicateHeaders(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	corsMw := New(WithOrigins("Foo"), WithMethods(http.MethodPut), WithHeaders("X-Foo"), WithMaxAge(time.Hour), WithCredentials(true))
+	wrapped := corsMw.Wrap(corsMw.Wrap(emptyHandler))
+
+	recorder := httptest.NewRecorder()
+	recorder.Header().Set("Access-Control-Allow-Origin", "Bar")
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodPut, "Foo", t))
+	for _, name := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Methods", "Access-Control-Allow-Headers", "Access-Control-Allow-Credentials", "Vary"} {
+		if vals := recorder.Header().Values(name); len(vals) != 1 {
+			t.Fatalf("unexpected header for %q: %q", name, vals)
+		}
+	}
+	validateHeaders("Foo", http.MethodPut, "X-Foo", "", recorder, t)
+}
+
+func TestPrivateNetwork(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		allow     bool
+		preflight bool
+		request   string
+		expected  string
+	}{
+		{true, true, "true", "true"},
+		{true, true, "", ""},
+		{true, true, "false", ""},
+		{true, false, "true", ""},
+		{false, true, "true", ""},
+	}
+
+	for _, test := range tests {
+		req := newRequest(http.MethodGet, "Foo", t)
+		if test.preflight {
+			req = newPreflightRequest("Foo", http.MethodGet, t)
+		}
+		if test.request != "" {
+			req.Header.Set("Access-Control-Request-Private-Network", test.request)
+		}
+		recorder := httptest.NewRecorder()
+		New(WithOrigins("Foo"), WithPrivateNetwork(test.allow)).Wrap(handler).ServeHTTP(recorder, req)
+		if val := recorder.Header().Get("Access-Control-Allow-Private-Network"); val != test.expected {
+			t.Fatal("unexpected header for \"Access-Control-Allow-Private-Network\":", val)
+		}
+	}
+}
+
+func TestMaxAgeValues(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		age      time.Duration
+		expected string
+	}{
+		{-time.Second, "-1"},
+		{-time.Hour, "-1"},
+		{0, ""},
+		{90 * time.Second, "90"},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		New(WithOrigins("Foo"), WithMaxAge(test.age)).Wrap(emptyHandler).ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodGet, t))
+		validateHeaders("Foo", "", "", test.expected, recorder, t)
+	}
+}
+
+func TestRequireOriginHeader(t *testing.T) {
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	called = false
+	recorder := httptest.NewRecorder()
+	New(WithOrigins("*"), WithMethods(http.MethodPut), WithRequireOriginHeader(true)).Wrap(handler).ServeHTTP(recorder, newPreflightRequest("", http.MethodPut, t))
+	validateHeaders("", "", "", "", recorder, t)
+	if !called {
+		t.Fatal("handler not called for request without origin")
+	}
+
+	called = false
+	recorder = httptest.NewRecorder()
+	New(WithOrigins("*"), WithMethods(http.MethodPut), WithRequireOriginHeader(false)).Wrap(handler).ServeHTTP(recorder, newRequest(http.MethodGet, "", t))
+	validateHeaders("*", http.MethodPut, "", "", recorder, t)
+	if !called {
+		t.Fatal("handler not called for request without origin")
+	}
+
+	called = false
+	recorder = httptest.NewRecorder()
+	New(WithOrigins("Foo"), WithMethods(http.MethodPut), WithRequireOriginHeader(false)).Wrap(handler).ServeHTTP(recorder, newPreflightRequest("", http.MethodPut, t))
+	validateHeaders("", http.MethodPut, "", "", recorder, t)
+	if called || recorder.Code != http.StatusNoContent {
+		t.Fatal("unexpected preflight response:", recorder.Code, called)
+	}
+}
+
+func TestNormalizeOrigin(t *testing.T) {
+	tests := []struct {
+		origin, expected string
+	}{
+		{"https://example.com", "https://example.com"},
+		{"HTTPS://Example.COM", "https://example.com"},
+		{"https://example.com:443", "https://example.com"},
+		{"HTTPS://Example.COM:443", "https://example.com"},
+		{"http://example.com:80", "http://example.com"},
+		{"http://example.com:443", "http://example.com:443"},
+		{"https://example.com:80", "https://example.com:80"},
+		{"https://example.com:8443", "https://example.com:8443"},
+		{"http://[::1]:80", "http://[::1]"},
+		{"http://[::1]:8080", "http://[::1]:8080"},
+		{"https://example.com/", "https://example.com"},
+		{"HTTPS://Example.com:443/path", "https://example.com"},
+		{"null", "null"},
+		{"Foo", "Foo"},
+	}
+
+	for _, test := range tests {
+		if val := normalizeOrigin(test.origin); val != test.expected {
+			t.Fatalf("unexpected normalized origin for %q: %q", test.origin, val)
+		}
+	}
+}
+
+func TestOriginNormalization(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("https://Example.com:443", "*.Tenant.COM")).Wrap(emptyHandler)
+
+	for _, origin := range []string{"https://example.com", "HTTPS://EXAMPLE.COM:443", "https://A.tenant.com"} {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, origin, t))
+		validateHeaders(origin, "", "", "", recorder, t)
+	}
+
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "https://example.com:8443", t))
+	validateHeaders("", "", "", "", recorder, t)
+}
+
+func TestAllowAll(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	corsMw := New(WithCredentials(true), WithAllowAll())
+	if err := corsMw.Validate(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	corsMw.Wrap(emptyHandler).ServeHTTP(recorder, newPreflightRequest("https://any.example.com", http.MethodDelete, t))
+	validateHeaders("*", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS", "*", "0", recorder, t)
+	if val := recorder.Header().Get("Access-Control-Allow-Credentials"); val != "" {
+		t.Fatal("unexpected header for \"Access-Control-Allow-Credentials\":", val)
+	}
+}
+
+func TestWrapFuncMatchesWrap(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	corsMw := New(WithOrigins("Foo"), WithMethods(http.MethodPut), WithMaxAge(time.Hour))
+
+	for _, req := range []*http.Request{newRequest(http.MethodPut, "Foo", t), newPreflightRequest("Foo", http.MethodPut, t)} {
+		wrappedRecorder := httptest.NewRecorder()
+		corsMw.Wrap(http.HandlerFunc(handler)).ServeHTTP(wrappedRecorder, req)
+
+		var fn http.HandlerFunc = corsMw.WrapFunc(handler)
+		recorder := httptest.NewRecorder()
+		fn(recorder, req)
+
+		if recorder.Code != wrappedRecorder.Code {
+			t.Fatal("unexpected status code:", recorder.Code)
+		}
+		validateHeaders(wrappedRecorder.Header().Get("Access-Control-Allow-Origin"),
+			wrappedRecorder.Header().Get("Access-Control-Allow-Methods"),
+			wrappedRecorder.Header().Get("Access-Control-Allow-Headers"),
+			wrappedRecorder.Header().Get("Access-Control-Max-Age"), recorder, t)
+	}
+}
+
+func TestAllowAllConstructor(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	recorder := httptest.NewRecorder()
+	AllowAll().Wrap(emptyHandler).ServeHTTP(recorder, newRequest(http.MethodGet, "https://arbitrary.example.net", t))
+	if val := recorder.Header().Get("Access-Control-Allow-Origin"); val != "*" {
+		t.Fatal("unexpected header for \"Access-Control-Allow-Origin\":", val)
+	}
+}
+
+func TestPresets(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name                                          string
+		configs                                       []ConfigFunc
+		method                                        string
+		origin, methods, headers, maxAge, credentials string
+	}{
+		{"permissive", Permissive(), http.MethodPut, "*", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS", "*", "0", ""},
+		{"strict", Strict(), http.MethodPost, "", "GET, POST, OPTIONS", "", "", "true"},
+		{"strict with origin", append(Strict(), WithOrigins("Foo")), http.MethodPost, "Foo", "GET, POST, OPTIONS", "", "", "true"},
+		{"strict with disallowed method", append(Strict(), WithOrigins("Foo")), http.MethodPut, "Foo", "", "", "", "true"},
+		{"strict after origin", append([]ConfigFunc{WithOrigins("Foo")}, Strict()...), http.MethodPost, "Foo", "GET, POST, OPTIONS", "", "", "true"},
+		{"api", API(), http.MethodPatch, "", "GET, POST, PUT, PATCH, DELETE", "Content-Type, Authorization", "", ""},
+		{"api with origin", append(API(), WithOrigins("Foo")), http.MethodDelete, "Foo", "GET, POST, PUT, PATCH, DELETE", "Content-Type, Authorization", "", ""},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		New(test.configs...).Wrap(emptyHandler).ServeHTTP(recorder, newPreflightRequest("Foo", test.method, t))
+		validateHeaders(test.origin, test.methods, test.headers, test.maxAge, recorder, t)
+		if val := recorder.Header().Get("Access-Control-Allow-Credentials"); val != test.credentials {
+			t.Fatalf("%s: unexpected header for \"Access-Control-Allow-Credentials\": %q", test.name, val)
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	var decisions []string
+	logger := func(r *http.Request, decision string) {
+		decisions = append(decisions, decision)
+	}
+	wrapped := New(WithOrigins("Foo"), WithLogger(logger)).Wrap(emptyHandler)
+
+	for _, req := range []*http.Request{
+		newRequest(http.MethodGet, "Foo", t),
+		newRequest(http.MethodGet, "Bar", t),
+		newPreflightRequest("Foo", http.MethodGet, t),
+		newPreflightRequest("Bar", http.MethodGet, t),
+		newRequest(http.MethodGet, "", t),
+	} {
+		wrapped.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if fmt.Sprint(decisions) != "[allowed rejected preflight rejected no-origin]" {
+		t.Fatal("unexpected decisions:", decisions)
+	}
+}
+
+func TestLoggerPanic(t *testing.T) {
+	panicHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("handler failed")
+	})
+	decision := ""
+	wrapped := New(WithOrigins("Foo"), WithLogger(func(r *http.Request, d string) {
+		decision = d
+	})).Wrap(panicHandler)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic from handler")
+			}
+		}()
+		wrapped.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodGet, "Foo", t))
+	}()
+
+	if decision != "allowed" {
+		t.Fatal("unexpected decision:", decision)
+	}
+}
+
+func TestLoggerNil(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	recorder := httptest.NewRecorder()
+	New(WithOrigins("Foo"), WithLogger(nil)).Wrap(emptyHandler).ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	validateHeaders("Foo", "", "", "", recorder, t)
+}
+
+func TestSecure(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	corsMw := Secure()
+	if val := corsMw.AllowedMethods(); !equalStrings(val, http.MethodGet, http.MethodHead, http.MethodPost) {
+		t.Fatal("unexpected allowed methods:", val)
+	}
+
+	recorder := httptest.NewRecorder()
+	corsMw.Wrap(emptyHandler).ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodGet, t))
+	validateHeaders("", "GET, HEAD, POST", "", "600", recorder, t)
+
+	recorder = httptest.NewRecorder()
+	corsMw.Clone(WithOrigins("Foo")).Wrap(emptyHandler).ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodGet, t))
+	validateHeaders("Foo", "GET, HEAD, POST", "", "600", recorder, t)
+}
+
+func TestContextOverride(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	override := New(WithOrigins("Bar"), WithMethods(http.MethodPost))
+	wrapped := New(WithOrigins("Foo"), WithMethods(http.MethodGet)).Wrap(emptyHandler)
+	withOverride := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithContextOverride(r.Context(), override)))
+		})
+	}
+
+	recorder := httptest.NewRecorder()
+	withOverride(wrapped).ServeHTTP(recorder, newRequest(http.MethodGet, "Bar", t))
+	validateHeaders("Bar", http.MethodPost, "", "", recorder, t)
+
+	recorder = httptest.NewRecorder()
+	withOverride(wrapped).ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	validateHeaders("", http.MethodPost, "", "", recorder, t)
+
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	validateHeaders("Foo", http.MethodGet, "", "", recorder, t)
+}
+
+func TestContextOverrideMissing(t *testing.T) {
+	if _, ok := ContextOverride(context.Background()); ok {
+		t.Fatal("unexpected override in empty context")
+	}
+	if _, ok := ContextOverride(WithContextOverride(context.Background(), nil)); ok {
+		t.Fatal("unexpected override for nil Cors")
+	}
+	override := New()
+	if o, ok := ContextOverride(WithContextOverride(context.Background(), override)); !ok || o != override {
+		t.Fatal("override not found in context")
+	}
+}
+
+func TestNewWithError(t *testing.T) {
+	if _, err := NewWithError(WithOrigins("https://example.com"), WithOriginPatterns(`^https://(`)); err == nil {
+		t.Fatal("expected error for invalid origin pattern")
+	}
+	if _, err := NewWithError(WithOrigins("https://*foo.example.com")); err == nil {
+		t.Fatal("expected error for invalid wildcard origin")
+	}
+	if _, err := NewWithError(WithOrigins("https://example.com"), WithPreflightStatus(http.StatusInternalServerError)); err == nil {
+		t.Fatal("expected error for invalid preflight status")
+	}
+
+	c, err := NewWithError(WithOrigins("https://example.com"), WithOriginPatterns(`^https://[a-z]+\.example\.com$`))
+	if err != nil || c == nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	c := New(WithOrigins("Foo"), WithMethods(http.MethodGet), WithHeaders("X-Foo"), WithMaxAge(time.Minute), WithExposedHeaders("X-Bar"))
+
+	recorder := httptest.NewRecorder()
+	if !c.Apply(recorder, newPreflightRequest("Foo", http.MethodGet, t)) {
+		t.Fatal("expected preflight request to be answered")
+	}
+	validateHeaders("Foo", http.MethodGet, "X-Foo", "60", recorder, t)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatal("unexpected status:", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	if c.Apply(recorder, newRequest(http.MethodGet, "Foo", t)) {
+		t.Fatal("expected request not to be answered")
+	}
+	validateHeaders("Foo", http.MethodGet, "X-Foo", "", recorder, t)
+	if recorder.Header().Get("Access-Control-Expose-Headers") != "X-Bar" {
+		t.Fatal("missing expose headers")
+	}
+	recorder.WriteHeader(http.StatusTeapot)
+	if recorder.Code != http.StatusTeapot {
+		t.Fatal("unexpected status:", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	if New(WithOrigins("Foo"), WithMethods(http.MethodGet), WithOptionsPassthrough()).Apply(recorder, newPreflightRequest("Foo", http.MethodGet, t)) {
+		t.Fatal("expected preflight request to be passed through")
+	}
+	validateHeaders("Foo", http.MethodGet, "", "", recorder, t)
+}
+
+func TestOriginMethods(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	c := New(
+		WithOrigins("https://read.example.com", "https://write.example.com"),
+		WithMethods(http.MethodGet),
+		WithOriginMethods("https://write.example.com", http.MethodGet, http.MethodPost, http.MethodDelete),
+	)
+	wrapped := c.Wrap(emptyHandler)
+
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newPreflightRequest("https://write.example.com", http.MethodDelete, t))
+	validateHeaders("https://write.example.com", "GET, POST, DELETE", "", "", recorder, t)
+
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newPreflightRequest("https://read.example.com", http.MethodDelete, t))
+	validateHeaders("https://read.example.com", "", "", "", recorder, t)
+
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "https://read.example.com", t))
+	validateHeaders("https://read.example.com", http.MethodGet, "", "", recorder, t)
+
+	clone := c.Clone(WithOriginMethods("https://write.example.com", http.MethodPut))
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "https://write.example.com", t))
+	validateHeaders("https://write.example.com", "GET, POST, DELETE", "", "", recorder, t)
+	recorder = httptest.NewRecorder()
+	clone.Wrap(emptyHandler).ServeHTTP(recorder, newRequest(http.MethodGet, "https://write.example.com", t))
+	validateHeaders("https://write.example.com", http.MethodPut, "", "", recorder, t)
+}
+
+func TestDebugLogger(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	var buf bytes.Buffer
+	wrapped := New(WithOrigins("Foo"), WithMethods(http.MethodGet), WithDebugLogger(log.New(&buf, "", 0))).Wrap(emptyHandler)
+
+	wrapped.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodGet, "Bar", t))
+	if !strings.Contains(buf.String(), `origin "Bar" rejected`) {
+		t.Fatal("rejection not logged:", buf.String())
+	}
+
+	buf.Reset()
+	wrapped.ServeHTTP(httptest.NewRecorder(), newPreflightRequest("Foo", http.MethodDelete, t))
+	if !strings.Contains(buf.String(), `origin "Foo" accepted`) || !strings.Contains(buf.String(), `method "DELETE" is not in "GET"`) {
+		t.Fatal("denied preflight not logged:", buf.String())
+	}
+	if !strings.Contains(buf.String(), "Access-Control-Allow-Origin: Foo") {
+		t.Fatal("emitted headers not logged:", buf.String())
+	}
+
+	var nilLogger *log.Logger
+	wrapped = New(WithOrigins("Foo"), WithDebugLogger(nilLogger)).Wrap(emptyHandler)
+	wrapped.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodGet, "Bar", t))
+}
+
+func TestApplyPreflight(t *testing.T) {
+	c := New(WithOrigins("Foo"), WithMethods(http.MethodGet), WithHeaders("X-Foo"), WithMaxAge(time.Minute), WithExposedHeaders("X-Bar"))
+	recorder := httptest.NewRecorder()
+	c.ApplyPreflight(recorder, newPreflightRequest("Foo", http.MethodGet, t))
+	validateHeaders("Foo", http.MethodGet, "X-Foo", "60", recorder, t)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatal("unexpected status:", recorder.Code)
+	}
+	if recorder.Header().Get("Access-Control-Expose-Headers") != "" {
+		t.Fatal("unexpected expose headers on preflight")
+	}
+}
+
+func TestApplyActual(t *testing.T) {
+	c := New(WithOrigins("Foo"), WithMethods(http.MethodGet), WithMaxAge(time.Minute), WithExposedHeaders("X-Bar"), WithCredentials(true))
+	recorder := httptest.NewRecorder()
+	c.ApplyActual(recorder, newRequest(http.MethodGet, "Foo", t))
+	validateHeaders("Foo", http.MethodGet, "", "", recorder, t)
+	if recorder.Header().Get("Access-Control-Expose-Headers") != "X-Bar" {
+		t.Fatal("missing expose headers")
+	}
+	if recorder.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatal("missing allow credentials")
+	}
+	if recorder.Code != http.StatusOK {
+		t.Fatal("unexpected status:", recorder.Code)
+	}
+}
+
+func TestPreflightPassthrough(t *testing.T) {
+	for _, passthrough := range []bool{true, false} {
+		called := false
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			w.WriteHeader(http.StatusAccepted)
+		})
+		wrapped := New(WithOrigins("Foo"), WithMethods(http.MethodGet), WithPreflightPassthrough(passthrough)).Wrap(handler)
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodGet, t))
+		validateHeaders("Foo", http.MethodGet, "", "", recorder, t)
+		if called != passthrough {
+			t.Fatalf("passthrough %v: handler called %v", passthrough, called)
+		}
+		if want := map[bool]int{true: http.StatusAccepted, false: http.StatusNoContent}[passthrough]; recorder.Code != want {
+			t.Fatalf("passthrough %v: unexpected status %d", passthrough, recorder.Code)
+		}
+	}
+}
+
+func TestRejectionHandler(t *testing.T) {
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	rejections := 0
+	c := New(WithOrigins("Foo"), WithMethods(http.MethodGet), WithRejectionHandler(func(w http.ResponseWriter, r *http.Request) {
+		rejections++
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+	}))
+	wrapped := c.Wrap(handler)
+
+	for _, r := range []*http.Request{newRequest(http.MethodGet, "Bar", t), newPreflightRequest("Bar", http.MethodGet, t)} {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, r)
+		if recorder.Code != http.StatusForbidden {
+			t.Fatal("unexpected status:", recorder.Code)
+		}
+		if recorder.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Fatal("unexpected allow origin header")
+		}
+	}
+	if called {
+		t.Fatal("wrapped handler called for rejected origin")
+	}
+	if rejections != 2 {
+		t.Fatal("unexpected number of rejections:", rejections)
+	}
+
+	recorder := httptest.NewRecorder()
+	if !c.Apply(recorder, newRequest(http.MethodGet, "Bar", t)) || recorder.Code != http.StatusForbidden {
+		t.Fatal("expected Apply to call the rejection handler")
+	}
+
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	if !called || rejections != 3 {
+		t.Fatal("wrapped handler not called for accepted origin")
+	}
+}
+
+func TestReflectWildcardHeaders(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, test := range []struct {
+		reflect bool
+		headers string
+	}{
+		{true, "X-Foo, X-Bar"},
+		{false, "*"},
+	} {
+		wrapped := New(WithOrigins("Foo"), WithMethods(http.MethodGet), WithHeaders("*"), WithReflectRequestHeaders(test.reflect)).Wrap(emptyHandler)
+		recorder := httptest.NewRecorder()
+		r := newPreflightRequest("Foo", http.MethodGet, t)
+		r.Header.Set("Access-Control-Request-Headers", "X-Foo, X-Bar")
+		wrapped.ServeHTTP(recorder, r)
+		validateHeaders("Foo", http.MethodGet, test.headers, "", recorder, t)
+
+		recorder = httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newPreflightRequest("Foo", http.MethodGet, t))
+		validateHeaders("Foo", http.MethodGet, "*", "", recorder, t)
+	}
+}
+
+func TestWrapStaticAllocs(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("*"), WithMethods(http.MethodGet, http.MethodPost), WithHeaders("Content-Type"), WithMaxAge(time.Hour), WithExposedHeaders("X-Foo")).Wrap(emptyHandler)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Origin", "https://example.com")
+	w := httptest.NewRecorder()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		for k := range w.Header() {
+			delete(w.Header(), k)
+		}
+		wrapped.ServeHTTP(w, r)
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations for a static configuration, got %v", allocs)
+	}
+}
+
+func BenchmarkWrapStatic(b *testing.B) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("*"), WithMethods(http.MethodGet, http.MethodPost), WithHeaders("Content-Type"), WithMaxAge(time.Hour), WithExposedHeaders("X-Foo")).Wrap(emptyHandler)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Origin", "https://example.com")
+	w := httptest.NewRecorder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for k := range w.Header() {
+			delete(w.Header(), k)
+		}
+		wrapped.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkWrapPreflight(b *testing.B) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("https://example.com"), WithMethods(http.MethodGet, http.MethodPost), WithHeaders("Content-Type"), WithMaxAge(time.Hour)).Wrap(emptyHandler)
+	r := httptest.NewRequest(http.MethodOptions, "/", nil)
+	r.Header.Set("Origin", "https://example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wrapped.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
+
+func TestPreparedHeadersNotShared(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		w.Header().Add("Access-Control-Allow-Methods", http.MethodPut)
+	})
+	wrapped := New(WithOrigins("Foo"), WithMethods(http.MethodGet)).Wrap(handler)
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+		if v := recorder.Header().Values("Vary"); len(v) != 2 || v[0] != "Origin" || v[1] != "Accept" {
+			t.Fatal("unexpected Vary header:", v)
+		}
+		if v := recorder.Header().Values("Access-Control-Allow-Methods"); len(v) != 2 || v[0] != http.MethodGet {
+			t.Fatal("unexpected methods header:", v)
+		}
+	}
+}
+
+func TestTimingAllowOrigin(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, test := range []struct {
+		timing []string
+		origin string
+		want   string
+	}{
+		{[]string{"*"}, "https://foo.example.com", "*"},
+		{[]string{"https://foo.example.com", "https://bar.example.com"}, "https://bar.example.com", "https://bar.example.com"},
+		{[]string{"https://*.example.com"}, "https://foo.example.com", "https://foo.example.com"},
+		{[]string{"https://foo.example.com"}, "https://baz.example.com", ""},
+		{nil, "https://foo.example.com", ""},
+	} {
+		wrapped := New(WithOrigins("*"), WithMethods(http.MethodGet), WithTimingAllowOrigin(test.timing...)).Wrap(emptyHandler)
+
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, test.origin, t))
+		if v := recorder.Header().Get("Timing-Allow-Origin"); v != test.want {
+			t.Fatalf("%v: unexpected Timing-Allow-Origin %q for %q", test.timing, v, test.origin)
+		}
+
+		recorder = httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newPreflightRequest(test.origin, http.MethodGet, t))
+		if v := recorder.Header().Get("Timing-Allow-Origin"); v != "" {
+			t.Fatalf("%v: unexpected Timing-Allow-Origin %q on preflight", test.timing, v)
+		}
+	}
+}
+
+func TestMaxAgeSeconds(t *testing.T) {
+	for _, test := range []struct {
+		seconds int
+		want    string
+	}{
+		{0, "0"},
+		{86400, "86400"},
+	} {
+		c, err := NewWithError(WithOrigins("https://example.com"), WithMethods(http.MethodGet), WithMaxAgeSeconds(test.seconds))
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if c.maxAge != test.want {
+			t.Fatalf("%d: unexpected max age %q", test.seconds, c.maxAge)
+		}
+	}
+
+	if _, err := NewWithError(WithOrigins("https://example.com"), WithMethods(http.MethodGet), WithMaxAgeSeconds(-1)); err == nil {
+		t.Fatal("expected error for negative max age")
+	}
+
+	if c := New(WithMaxAge(time.Minute), WithMaxAgeSeconds(10)); c.MaxAge() != 10*time.Second {
+		t.Fatal("expected last max age to win:", c.MaxAge())
+	}
+	if c := New(WithMaxAgeSeconds(10), WithMaxAge(time.Minute)); c.MaxAge() != time.Minute {
+		t.Fatal("expected last max age to win:", c.MaxAge())
+	}
+}
+
+func TestOriginsFromEnv(t *testing.T) {
+	t.Setenv("CORS_TEST_ORIGINS", " https://foo.example.com, https://bar.example.com,,\thttps://baz.example.com ")
+	c := New(WithOriginsFromEnv("CORS_TEST_ORIGINS"))
+	if !equalStrings(c.AllowedOrigins(), "https://foo.example.com", "https://bar.example.com", "https://baz.example.com") {
+		t.Fatalf("unexpected origins %q", c.AllowedOrigins())
+	}
+
+	t.Setenv("CORS_TEST_ORIGINS", "")
+	if c := New(WithOriginsFromEnv("CORS_TEST_ORIGINS")); !equalStrings(c.AllowedOrigins()) {
+		t.Fatalf("unexpected origins %q", c.AllowedOrigins())
+	}
+}
+
+func TestOriginsDeduplicated(t *testing.T) {
+	c := New(WithOrigins("https://a.com", "https://b.com", "https://a.com", "HTTPS://A.com:443"))
+	if len(c.allowedOrigins) != 2 || c.allowedOrigins[0] != "https://a.com" || c.allowedOrigins[1] != "https://b.com" {
+		t.Fatal("unexpected origins:", c.allowedOrigins)
+	}
+	if !equalStrings(c.AllowedOrigins(), "https://a.com", "https://b.com") {
+		t.Fatalf("unexpected origins %q", c.AllowedOrigins())
+	}
+}
+
+func TestMethodHeaderNormalization(t *testing.T) {
+	c := New(WithMethods(" get", "Post ", "", "delete"), WithHeaders(" content-type ", "x-custom-header", "*"))
+	if !equalStrings(c.AllowedMethods(), "GET", "POST", "DELETE") {
+		t.Fatalf("unexpected methods %q", c.AllowedMethods())
+	}
+	if !equalStrings(c.AllowedHeaders(), "Content-Type", "X-Custom-Header", "*") {
+		t.Fatalf("unexpected headers %q", c.AllowedHeaders())
+	}
+}
+
+func TestOnlyMatchedOriginSent(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("https://a.com", "https://b.com", "http://a.com:8080")).Wrap(emptyHandler)
+	for _, test := range []struct {
+		origin string
+		want   string
+	}{
+		{"https://a.com", "https://a.com"},
+		{"https://b.com", "https://b.com"},
+		{"http://a.com:8080", "http://a.com:8080"},
+		{"http://a.com", ""},
+		{"https://a.com:8080", ""},
+		{"https://c.com", ""},
+	} {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, test.origin, t))
+		v := recorder.Header().Values("Access-Control-Allow-Origin")
+		if (test.want == "" && len(v) != 0) || (test.want != "" && (len(v) != 1 || v[0] != test.want)) {
+			t.Fatalf("%s: unexpected Access-Control-Allow-Origin %q", test.origin, v)
+		}
+	}
+}
+
+func TestPortAgnosticOrigins(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, test := range []struct {
+		agnostic bool
+		origin   string
+		want     string
+	}{
+		{true, "http://localhost:3000", "http://localhost:3000"},
+		{true, "http://localhost", "http://localhost"},
+		{true, "https://localhost:3000", ""},
+		{true, "http://[::1]:5173", "http://[::1]:5173"},
+		{true, "http://foo.example.com:8080", "http://foo.example.com:8080"},
+		{false, "http://localhost:3000", ""},
+		{false, "http://localhost:4000", "http://localhost:4000"},
+	} {
+		configs := []ConfigFunc{WithOrigins("http://localhost:4000", "http://[::1]:4000", "http://*.example.com")}
+		if test.agnostic {
+			configs = append(configs, WithPortAgnosticOrigins())
+		}
+		wrapped := New(configs...).Wrap(emptyHandler)
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, test.origin, t))
+		validateHeaders(test.want, "", "", "", recorder, t)
+	}
+}
+
+func TestNewWithErrorWildcardCredentials(t *testing.T) {
+	for _, configs := range [][]ConfigFunc{
+		{WithOrigins("*"), WithMethods(http.MethodGet), WithCredentials(true)},
+		{WithCredentials(true), WithOrigins("https://example.com", "*"), WithMethods(http.MethodGet)},
+	} {
+		c, err := NewWithError(configs...)
+		if err == nil || c != nil {
+			t.Fatal("expected error for wildcard origin with credentials")
+		}
+		if !strings.Contains(err.Error(), "credentials") {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	if _, err := NewWithError(WithOrigins("*"), WithMethods(http.MethodGet), WithCredentials(true), WithCredentials(false)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestNullOrigin(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, test := range []struct {
+		name    string
+		configs []ConfigFunc
+		want    string
+	}{
+		{"default", []ConfigFunc{WithOrigins("https://example.com")}, ""},
+		{"allowed", []ConfigFunc{WithOrigins("https://example.com"), WithAllowNullOrigin(true)}, "null"},
+		{"denied", []ConfigFunc{WithOrigins("https://example.com"), WithAllowNullOrigin(true), WithAllowNullOrigin(false)}, ""},
+		{"wildcard allowed", []ConfigFunc{WithOrigins("*"), WithAllowNullOrigin(true)}, "null"},
+		{"listed", []ConfigFunc{WithOrigins("https://example.com", "null")}, "null"},
+		{"validator", []ConfigFunc{WithOriginValidator(func(o string) bool { return o == "null" })}, "null"},
+		{"wildcard", []ConfigFunc{WithOrigins("*")}, "*"},
+		{"wildcard credentials", []ConfigFunc{WithOrigins("*"), WithCredentials(true)}, ""},
+		{"wildcard credentials allowed", []ConfigFunc{WithOrigins("*"), WithCredentials(true), WithAllowNullOrigin(true)}, "null"},
+	} {
+		wrapped := New(test.configs...).Wrap(emptyHandler)
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "null", t))
+		if v := recorder.Header().Get("Access-Control-Allow-Origin"); v != test.want {
+			t.Fatalf("%s: unexpected Access-Control-Allow-Origin %q", test.name, v)
+		}
+	}
+}
+
+func TestInjectOptions(t *testing.T) {
+	c := New(WithOrigins("Foo"), WithMethods(http.MethodGet, http.MethodPost), WithHeaders("X-Foo"), WithMaxAge(time.Minute))
+	newMux := func() *http.ServeMux {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "users ", r.Method)
+		})
+		mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "api ", r.Method)
+		})
+		return mux
+	}
+
+	for _, patterns := range [][]string{nil, {"/users", "/api/"}} {
+		h := InjectOptions(newMux(), c, patterns...)
+		for _, path := range []string{"/users", "/api/items"} {
+			r := newPreflightRequest("Foo", http.MethodPost, t)
+			r.URL.Path = path
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, r)
+			if recorder.Code != http.StatusNoContent || recorder.Body.Len() != 0 {
+				t.Fatalf("%v %s: unexpected response %d %q", patterns, path, recorder.Code, recorder.Body)
+			}
+			validateHeaders("Foo", "GET, POST", "X-Foo", "60", recorder, t)
+		}
+
+		for _, test := range []struct {
+			r    *http.Request
+			path string
+			code int
+			body string
+		}{
+			{newRequest(http.MethodGet, "Foo", t), "/users", http.StatusOK, "users GET"},
+			{newRequest(http.MethodOptions, "", t), "/users", http.StatusOK, "users OPTIONS"},
+			{newRequest(http.MethodGet, "", t), "/unknown", http.StatusNotFound, "404 page not found\n"},
+			{newPreflightRequest("Foo", http.MethodPost, t), "/unknown", http.StatusNotFound, "404 page not found\n"},
+		} {
+			test.r.URL.Path = test.path
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, test.r)
+			if recorder.Code != test.code || recorder.Body.String() != test.body {
+				t.Fatalf("%v %s %s: unexpected response %d %q", patterns, test.r.Method, test.path, recorder.Code, recorder.Body)
+			}
+		}
+	}
+
+	h := InjectOptions(newMux(), c, "/users")
+	r := newPreflightRequest("Foo", http.MethodPost, t)
+	r.URL.Path = "/api/items"
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, r)
+	if recorder.Body.String() != "api OPTIONS" || recorder.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("unexpected response %d %q for a path outside the patterns", recorder.Code, recorder.Body)
+	}
+}
+
+func TestSloppyOrigins(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := New(WithOrigins("https://Example.com/", "HTTP://LOCALHOST:3000/")).Wrap(emptyHandler)
+	for _, test := range []struct {
+		origin, want string
+	}{
+		{"https://example.com", "https://example.com"},
+		{"https://EXAMPLE.com", "https://EXAMPLE.com"},
+		{"http://localhost:3000", "http://localhost:3000"},
+		{"https://example.com.evil.com", ""},
+	} {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, test.origin, t))
+		validateHeaders(test.want, "", "", "", recorder, t)
+	}
+}
+
+func ExampleWithOriginFunc() {
+	// With github.com/rs/cors:
+	//
+	//	c := cors.New(cors.Options{
+	//		AllowOriginFunc:  func(origin string) bool { return strings.HasSuffix(origin, ".example.com") },
+	//		AllowedMethods:   []string{http.MethodGet, http.MethodPost},
+	//		AllowedHeaders:   []string{"Content-Type"},
+	//		AllowCredentials: true,
+	//	})
+	//	handler := c.Handler(mux)
+	//
+	// With this package:
+	mux := http.NewServeMux()
+	c := New(
+		WithOriginFunc(func(origin string) bool { return strings.HasSuffix(origin, ".example.com") }),
+		WithMethods(http.MethodGet, http.MethodPost),
+		WithHeaders("Content-Type"),
+		WithCredentials(true),
+	)
+	handler := c.Wrap(mux)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	fmt.Println(w.Header().Get("Access-Control-Allow-Origin"))
+	// Output: https://app.example.com
+}
+
+func TestAllowAllHeaders(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, test := range []struct {
+		credentials bool
+		want        string
+	}{
+		{false, "*"},
+		{true, "X-Foo, Content-Type"},
+	} {
+		wrapped := New(WithOrigins("https://example.com"), WithMethods(http.MethodPost), WithAllowAllHeaders(), WithCredentials(test.credentials)).Wrap(emptyHandler)
+		r := newPreflightRequest("https://example.com", http.MethodPost, t)
+		r.Header.Set("Access-Control-Request-Headers", "X-Foo, Content-Type")
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, r)
+		validateHeaders("https://example.com", http.MethodPost, test.want, "", recorder, t)
+	}
+}
+
+func TestHTTPSOnly(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, test := range []struct {
+		name    string
+		configs []ConfigFunc
+		origin  string
+		want    string
+	}{
+		{"https", []ConfigFunc{WithOrigins("https://example.com")}, "https://example.com", "https://example.com"},
+		{"http", []ConfigFunc{WithOrigins("*.example.com")}, "http://app.example.com", ""},
+		{"http upper case", []ConfigFunc{WithOrigins("*.example.com")}, "HTTP://app.example.com", ""},
+		{"wildcard", []ConfigFunc{WithOrigins("*")}, "http://example.com", ""},
+		{"validator", []ConfigFunc{WithOriginValidator(func(string) bool { return true })}, "http://example.com", ""},
+		{"not enforced", []ConfigFunc{WithOrigins("*.example.com"), WithHTTPSOnly(false)}, "http://app.example.com", "http://app.example.com"},
+	} {
+		wrapped := New(append([]ConfigFunc{WithHTTPSOnly(true)}, test.configs...)...).Wrap(emptyHandler)
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, test.origin, t))
+		validateHeaders(test.want, "", "", "", recorder, t)
+	}
+
+	if _, err := NewWithError(WithHTTPSOnly(true), WithOrigins("https://example.com", "http://example.com"), WithMethods(http.MethodGet)); err == nil {
+		t.Fatal("expected error for http origin")
+	}
+	if _, err := NewWithError(WithHTTPSOnly(true), WithOrigins("https://example.com"), WithMethods(http.MethodGet)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestHTTPSOnlyWildcardVary(t *testing.T) {
+	wrapped := New(WithAllowAll(), WithHTTPSOnly(true)).Wrap(http.NotFoundHandler())
+	for origin, want := range map[string]string{"https://a.com": "*", "http://a.com": ""} {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, origin, t))
+		if v := recorder.Header().Get("Access-Control-Allow-Origin"); v != want {
+			t.Fatalf("%s: unexpected Access-Control-Allow-Origin %q", origin, v)
+		}
+		if vary := recorder.Header().Values("Vary"); !equalStrings(vary, "Origin") {
+			t.Fatalf("%s: unexpected Vary %q", origin, vary)
+		}
+	}
+}
+
+func TestAllowAllMethods(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, test := range []struct {
+		credentials bool
+		want        string
+	}{
+		{false, "*"},
+		{true, http.MethodPatch},
+	} {
+		wrapped := New(WithOrigins("https://example.com"), WithAllowAllMethods(), WithCredentials(test.credentials)).Wrap(emptyHandler)
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newPreflightRequest("https://example.com", http.MethodPatch, t))
+		validateHeaders("https://example.com", test.want, "", "", recorder, t)
+		if test.credentials && !strings.Contains(strings.Join(recorder.Header().Values("Vary"), ","), "Access-Control-Request-Method") {
+			t.Fatal("missing Vary: Access-Control-Request-Method")
+		}
+	}
+}
+
+func TestRejectIPOrigins(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, test := range []struct {
+		reject bool
+		origin string
+		want   string
+	}{
+		{true, "http://192.168.1.5", ""},
+		{true, "http://192.168.1.5:8080", ""},
+		{true, "http://[::1]", ""},
+		{true, "http://[2001:db8::1]:8443", ""},
+		{true, "http://localhost", "http://localhost"},
+		{true, "https://example.com", "https://example.com"},
+		{false, "http://192.168.1.5", "http://192.168.1.5"},
+		{false, "http://[::1]", "http://[::1]"},
+	} {
+		wrapped := New(WithOrigins("*"), WithCredentials(true), WithRejectIPOrigins(test.reject)).Wrap(emptyHandler)
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, test.origin, t))
+		if v := recorder.Header().Get("Access-Control-Allow-Origin"); v != test.want {
+			t.Fatalf("%v %s: unexpected Access-Control-Allow-Origin %q", test.reject, test.origin, v)
+		}
+	}
+}
+
+func TestRejectIPOriginsWildcardVary(t *testing.T) {
+	wrapped := New(WithOrigins("*"), WithRejectIPOrigins(true)).Wrap(http.NotFoundHandler())
+	for origin, want := range map[string]string{"https://a.com": "*", "http://192.168.1.5": ""} {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, origin, t))
+		if v := recorder.Header().Get("Access-Control-Allow-Origin"); v != want {
+			t.Fatalf("%s: unexpected Access-Control-Allow-Origin %q", origin, v)
+		}
+		if vary := recorder.Header().Values("Vary"); !equalStrings(vary, "Origin") {
+			t.Fatalf("%s: unexpected Vary %q", origin, vary)
+		}
+	}
+}
+
+func TestDeferToExisting(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bespoke" {
+			w.Header().Set("Access-Control-Allow-Origin", "https://bespoke.example.com")
+			w.Header().Set("Vary", "Accept")
+		}
+		fmt.Fprint(w, "ok")
+	})
+	wrapped := New(WithOrigins("https://example.com"), WithMethods(http.MethodGet), WithCredentials(true), WithDeferToExisting()).Wrap(handler)
+
+	r := newRequest(http.MethodGet, "https://example.com", t)
+	r.URL.Path = "/bespoke"
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, r)
+	validateHeaders("https://bespoke.example.com", http.MethodGet, "", "", recorder, t)
+	if recorder.Result().Header.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatal("missing allow credentials")
+	}
+	if v := recorder.Result().Header.Values("Vary"); len(v) != 2 || v[0] != "Accept" || v[1] != "Origin" {
+		t.Fatal("unexpected Vary header:", v)
+	}
+
+	recorder = httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "https://example.com", t))
+	validateHeaders("https://example.com", http.MethodGet, "", "", recorder, t)
+
+	recorder = httptest.NewRecorder()
+	recorder.Header().Set("Access-Control-Allow-Methods", http.MethodPut)
+	wrapped.ServeHTTP(recorder, newPreflightRequest("https://example.com", http.MethodGet, t))
+	validateHeaders("https://example.com", http.MethodPut, "", "", recorder, t)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatal("unexpected status:", recorder.Code)
+	}
+
+	handlerNoWrite := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "https://bespoke.example.com")
+	})
+	recorder = httptest.NewRecorder()
+	New(WithOrigins("https://example.com"), WithDeferToExisting()).Wrap(handlerNoWrite).ServeHTTP(recorder, newRequest(http.MethodGet, "https://example.com", t))
+	validateHeaders("https://bespoke.example.com", "", "", "", recorder, t)
+}
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (r *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.hijacked = true
+	return nil, nil, nil
+}
+
+func TestDeferToExistingHijack(t *testing.T) {
+	recorder := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	New(WithOrigins("https://example.com"), WithDeferToExisting()).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			t.Fatal("expected the ResponseWriter to implement http.Hijacker")
+		}
+		if _, _, err := hj.Hijack(); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	})).ServeHTTP(recorder, newRequest(http.MethodGet, "https://example.com", t))
+	if !recorder.hijacked {
+		t.Fatal("expected the connection to be hijacked")
+	}
+
+	New(WithOrigins("https://example.com"), WithDeferToExisting()).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			t.Fatal("expected an error hijacking a ResponseWriter that doesn't support it")
+		}
+	})).ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodGet, "https://example.com", t))
+}
+
+func TestIsPreflight(t *testing.T) {
+	for _, method := range []string{http.MethodOptions, http.MethodGet} {
+		for _, origin := range []string{"https://example.com", ""} {
+			for _, requestMethod := range []string{http.MethodPost, ""} {
+				r := newRequest(method, origin, t)
+				if requestMethod != "" {
+					r.Header.Set("Access-Control-Request-Method", requestMethod)
+				}
+				want := method == http.MethodOptions && origin != "" && requestMethod != ""
+				if IsPreflight(r) != want {
+					t.Fatalf("%s %q %q: expected %v", method, origin, requestMethod, want)
+				}
+			}
+		}
+	}
+}
+
+func TestCloneIndependent(t *testing.T) {
+	base := New(WithOrigins("https://a.com", "https://b.com"), WithTimingAllowOrigin("https://a.com"), WithOriginMethods("https://a.com", http.MethodGet))
+	clone := base.Clone()
+
+	clone.allowedOrigins[0] = "https://changed.com"
+	clone.allowedOrigins = append(clone.allowedOrigins, "https://c.com")
+	clone.timingOrigins[0] = "https://changed.com"
+	clone.originMethods["https://a.com"] = http.MethodDelete
+	clone.Update(WithOrigins("https://d.com"))
+
+	if !equalStrings(base.AllowedOrigins(), "https://a.com", "https://b.com") {
+		t.Fatalf("original origins changed: %q", base.AllowedOrigins())
+	}
+	if base.timingOrigins[0] != "https://a.com" {
+		t.Fatal("original timing origins changed:", base.timingOrigins)
+	}
+	if base.originMethods["https://a.com"] != http.MethodGet {
+		t.Fatal("original origin methods changed:", base.originMethods)
+	}
+	if !equalStrings(clone.AllowedOrigins(), "https://d.com") {
+		t.Fatalf("unexpected clone origins: %q", clone.AllowedOrigins())
+	}
+}
+
+func TestMergeMethod(t *testing.T) {
+	users := New(WithOrigins("https://a.com", "https://b.com"), WithMethods(http.MethodGet, http.MethodPost), WithHeaders("Content-Type"), WithMaxAge(time.Hour), WithExposedHeaders("X-Total"))
+	billing := New(WithOrigins("https://b.com", "https://c.com"), WithMethods(http.MethodPost, http.MethodDelete), WithHeaders("Authorization"), WithMaxAge(time.Minute), WithCredentials(true))
+
+	m := users.Merge(billing)
+	if !equalStrings(m.AllowedOrigins(), "https://a.com", "https://b.com", "https://c.com") {
+		t.Fatalf("unexpected origins %q", m.AllowedOrigins())
+	}
+	if !equalStrings(m.AllowedMethods(), "GET", "POST", "DELETE") {
+		t.Fatalf("unexpected methods %q", m.AllowedMethods())
+	}
+	if !equalStrings(m.AllowedHeaders(), "Content-Type", "Authorization") {
+		t.Fatalf("unexpected headers %q", m.AllowedHeaders())
+	}
+	if m.MaxAge() != time.Hour {
+		t.Fatalf("unexpected max age %q", m.MaxAge())
+	}
+	if !m.credentials {
+		t.Fatal("expected credentials to be enabled")
+	}
+	if m.exposedHeaders != "X-Total" {
+		t.Fatalf("unexpected exposed headers %q", m.exposedHeaders)
+	}
+	if billing.Merge(users).MaxAge() != time.Hour {
+		t.Fatal("expected the larger max age regardless of order")
+	}
+	if !equalStrings(users.AllowedOrigins(), "https://a.com", "https://b.com") || users.credentials {
+		t.Fatal("original changed")
+	}
+
+	if u := users.Merge(New(WithOrigins("*"), WithHeaders("*"))); !equalStrings(u.AllowedOrigins(), "*") || !equalStrings(u.AllowedHeaders(), "*") {
+		t.Fatalf("unexpected wildcard union: %q %q", u.AllowedOrigins(), u.AllowedHeaders())
+	}
+	if u := users.Merge(nil); !equalStrings(u.AllowedOrigins(), users.AllowedOrigins()...) {
+		t.Fatalf("unexpected origins %q", u.AllowedOrigins())
+	}
+
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	recorder := httptest.NewRecorder()
+	m.Wrap(emptyHandler).ServeHTTP(recorder, newPreflightRequest("https://c.com", http.MethodGet, t))
+	validateHeaders("https://c.com", "GET, POST, DELETE", "Content-Type, Authorization", "3600", recorder, t)
+}
+
+func TestSetOriginsConcurrent(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	c := New(WithOrigins("https://a.com"))
+	wrapped := c.Wrap(emptyHandler)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				recorder := httptest.NewRecorder()
+				wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "https://a.com", t))
+				if v := recorder.Header().Get("Access-Control-Allow-Origin"); v != "" && v != "https://a.com" {
+					t.Errorf("unexpected Access-Control-Allow-Origin %q", v)
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 100; j++ {
+			if j%2 == 0 {
+				c.SetOrigins("https://b.com")
+			} else {
+				c.SetOrigins("https://a.com", "https://b.com")
+			}
+		}
+	}()
+	wg.Wait()
+
+	c.SetOrigins("https://c.com")
+	recorder := httptest.NewRecorder()
+	wrapped.ServeHTTP(recorder, newRequest(http.MethodGet, "https://c.com", t))
+	validateHeaders("https://c.com", "", "", "", recorder, t)
+}
+
+func TestOriginMethodsWildcardVary(t *testing.T) {
+	wrapped := New(WithAllowAll(), WithOriginMethods("https://a.com", http.MethodGet)).Wrap(http.NotFoundHandler())
+	for _, test := range []struct {
+		r       *http.Request
+		methods string
+	}{
+		{newPreflightRequest("https://a.com", http.MethodGet, t), http.MethodGet},
+		{newPreflightRequest("https://b.com", http.MethodPut, t), "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"},
+		{newRequest(http.MethodGet, "https://a.com", t), http.MethodGet},
+		{newRequest(http.MethodGet, "https://b.com", t), "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"},
+	} {
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, test.r)
+		origin := test.r.Header.Get("Origin")
+		if v := recorder.Header().Get("Access-Control-Allow-Methods"); v != test.methods {
+			t.Fatalf("%s %s: unexpected Access-Control-Allow-Methods %q", test.r.Method, origin, v)
+		}
+		if vary := recorder.Header().Values("Vary"); !equalStrings(vary, "Origin") {
+			t.Fatalf("%s %s: unexpected Vary %q", test.r.Method, origin, vary)
+		}
+	}
+}
+
+func TestOriginMethodsConcurrent(t *testing.T) {
+	c := New(WithOrigins("https://a.com"), WithMethods(http.MethodGet), WithOriginMethods("https://a.com", http.MethodPut))
+	wrapped := c.Wrap(http.NotFoundHandler())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				recorder := httptest.NewRecorder()
+				wrapped.ServeHTTP(recorder, newPreflightRequest("https://a.com", http.MethodPut, t))
+				if v := recorder.Header().Get("Access-Control-Allow-Methods"); v != "PUT" && v != "PUT, DELETE" {
+					t.Errorf("unexpected Access-Control-Allow-Methods %q", v)
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 100; j++ {
+			if j%2 == 0 {
+				c.Update(WithOriginMethods("https://a.com", http.MethodPut, http.MethodDelete))
+			} else {
+				c.Update(WithOriginMethods("https://a.com", http.MethodPut))
+			}
+			c.Update(WithOriginMethods(fmt.Sprintf("https://%d.com", j), http.MethodPost))
+		}
+	}()
+	wg.Wait()
+}
+
+func rawPreflight(t *testing.T, h http.Handler) (head, body string) {
+	t.Helper()
+	server := httptest.NewServer(h)
+	defer server.Close()
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "OPTIONS / HTTP/1.1\r\nHost: example.com\r\nOrigin: https://example.com\r\nAccess-Control-Request-Method: GET\r\nConnection: close\r\n\r\n")
+	raw, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	i := strings.Index(string(raw), "\r\n\r\n")
+	if i < 0 {
+		t.Fatalf("malformed response %q", raw)
+	}
+	return string(raw[:i]), string(raw[i+4:])
+}
+
+func TestPreflightContentLength(t *testing.T) {
+	for _, emit := range []bool{true, false} {
+		c := New(WithOrigins("https://example.com"), WithMethods(http.MethodGet), WithPreflightStatus(http.StatusOK), WithExplicitContentLength(emit))
+		// net/http adds Content-Length to empty responses that are complete
+		// when the handler returns, so the response is flushed to only get
+		// the header when the Cors sets it. Without it the response is
+		// chunked.
+		head, body := rawPreflight(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.ServeHTTP(w, r)
+			w.(http.Flusher).Flush()
+		}))
+		if !strings.HasPrefix(head, "HTTP/1.1 200 ") {
+			t.Fatalf("unexpected status in %q", head)
+		}
+		if strings.Contains(head, "\r\nContent-Length: 0") != emit || strings.Contains(head, "\r\nTransfer-Encoding: chunked") == emit {
+			t.Fatalf("emit %v: unexpected headers %q", emit, head)
+		}
+		if emit && body != "" || !emit && body != "0\r\n\r\n" {
+			t.Fatalf("emit %v: unexpected body %q", emit, body)
+		}
+
+		recorder := httptest.NewRecorder()
+		New(WithOrigins("https://example.com"), WithMethods(http.MethodGet), WithExplicitContentLength(emit)).ServeHTTP(recorder, newPreflightRequest("https://example.com", http.MethodGet, t))
+		if recorder.Code != http.StatusNoContent || recorder.Body.Len() != 0 {
+			t.Fatalf("unexpected response %d %q", recorder.Code, recorder.Body)
+		}
+		if got := recorder.Result().Header.Get("Content-Length"); (got == "0") != emit {
+			t.Fatalf("emit %v: unexpected Content-Length %q", emit, got)
+		}
+	}
+
+	head, body := rawPreflight(t, New(WithOrigins("https://example.com"), WithMethods(http.MethodGet)))
+	if !strings.HasPrefix(head, "HTTP/1.1 204 ") || body != "" {
+		t.Fatalf("unexpected response %q %q", head, body)
+	}
+}
+
+func TestVary(t *testing.T) {
+	c := New(WithOrigins("https://example.com"), WithMethods(http.MethodGet),
+		WithVary("Access-Control-Request-Method", "x-tenant", "X-Tenant"), WithVary("Accept-Encoding", "Origin"))
+	h := c.Wrap(http.NotFoundHandler())
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, newRequest(http.MethodGet, "https://example.com", t))
+	if vary := recorder.Header().Values("Vary"); !equalStrings(vary, "Origin", "Access-Control-Request-Method", "X-Tenant", "Accept-Encoding") {
+		t.Fatalf("unexpected Vary %q", vary)
+	}
+
+	recorder = httptest.NewRecorder()
+	recorder.Header().Set("Vary", "Accept-Encoding, X-Tenant")
+	h = New(WithDefaults(), WithVary("X-Tenant", "Accept-Encoding", "Accept-Language")).Wrap(http.NotFoundHandler())
+	h.ServeHTTP(recorder, newRequest(http.MethodGet, "", t))
+	if vary := recorder.Header().Values("Vary"); !equalStrings(vary, "Accept-Encoding, X-Tenant", "Accept-Language") {
+		t.Fatalf("unexpected Vary %q", vary)
+	}
+}
+
+func TestVaryApply(t *testing.T) {
+	c := New(WithOrigins("https://example.com"), WithMethods(http.MethodGet), WithVary("X-Tenant"))
+
+	recorder := httptest.NewRecorder()
+	c.ApplyPreflight(recorder, newPreflightRequest("https://example.com", http.MethodGet, t))
+	if vary := recorder.Header().Values("Vary"); !equalStrings(vary, "Origin", "X-Tenant") {
+		t.Fatalf("unexpected Vary %q", vary)
+	}
+
+	recorder = httptest.NewRecorder()
+	c.ApplyActual(recorder, newRequest(http.MethodGet, "https://example.com", t))
+	if vary := recorder.Header().Values("Vary"); !equalStrings(vary, "Origin", "X-Tenant") {
+		t.Fatalf("unexpected Vary %q", vary)
+	}
+}
+
+func TestStrictOrigin(t *testing.T) {
+	called := false
+	h := New(WithOrigins("https://example.com"), WithMethods(http.MethodGet, http.MethodPost), WithStrictOrigin()).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		code   int
+		called bool
+	}{
+		{"blocked cross-origin", newRequest(http.MethodPost, "https://evil.com", t), http.StatusForbidden, false},
+		{"blocked preflight", newPreflightRequest("https://evil.com", http.MethodPost, t), http.StatusForbidden, false},
+		{"no origin", newRequest(http.MethodPost, "", t), http.StatusOK, true},
+		{"same origin", newRequest(http.MethodPost, "https://api.example.org", t), http.StatusOK, true},
+		{"allowed cross-origin", newRequest(http.MethodPost, "https://example.com", t), http.StatusOK, true},
+		{"allowed preflight", newPreflightRequest("https://example.com", http.MethodPost, t), http.StatusNoContent, false},
+	}
+	for _, tt := range tests {
+		called = false
+		tt.req.Host = "api.example.org"
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, tt.req)
+		if recorder.Code != tt.code || called != tt.called {
+			t.Errorf("%s: got %d and called %v, expected %d and %v", tt.name, recorder.Code, called, tt.code, tt.called)
+		}
+	}
+}
+
+func TestStrictOriginRejectionHandler(t *testing.T) {
+	c := New(WithOrigins("https://example.com"), WithStrictOrigin(), WithRejectionHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	recorder := httptest.NewRecorder()
+	c.Wrap(http.NotFoundHandler()).ServeHTTP(recorder, newRequest(http.MethodDelete, "https://evil.com", t))
+	if recorder.Code != http.StatusTeapot {
+		t.Fatalf("unexpected status %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	if !New(WithOrigins("https://example.com"), WithStrictOrigin()).Apply(recorder, newRequest(http.MethodGet, "https://evil.com", t)) || recorder.Code != http.StatusForbidden {
+		t.Fatalf("unexpected status %d", recorder.Code)
+	}
+}
+
+func TestHeadersFunc(t *testing.T) {
+	c := New(WithOrigins("https://example.com"), WithMethods(http.MethodPost), WithHeaders("Content-Type"),
+		WithHeadersFunc(func(r *http.Request) []string {
+			if strings.HasPrefix(r.URL.Path, "/admin/") {
+				return []string{"x-admin-token", "content-type"}
+			}
+			return nil
+		}))
+	h := c.Wrap(http.NotFoundHandler())
+
+	for path, expected := range map[string]string{
+		"/admin/users": "Content-Type, X-Admin-Token",
+		"/users":       "Content-Type",
+	} {
+		req := newPreflightRequest("https://example.com", http.MethodPost, t)
+		req.URL.Path = path
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, req)
+		if got := recorder.Header().Get("Access-Control-Allow-Headers"); got != expected {
+			t.Errorf("%s: got allowed headers %q, expected %q", path, got, expected)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	New(WithOrigins("https://example.com"), WithHeadersFunc(func(r *http.Request) []string {
+		return []string{"X-Requested-With"}
+	})).ServeHTTP(recorder, newPreflightRequest("https://example.com", http.MethodGet, t))
+	if got := recorder.Header().Get("Access-Control-Allow-Headers"); got != "X-Requested-With" {
+		t.Fatalf("unexpected allowed headers %q", got)
+	}
+}
+
+func TestMaxAgeCap(t *testing.T) {
+	var logged bytes.Buffer
+	c := New(WithOrigins("https://example.com"), WithMethods(http.MethodGet), WithMaxAgeCap(),
+		WithMaxAge(30*24*time.Hour), WithDebugLogger(log.New(&logged, "", 0)))
+
+	recorder := httptest.NewRecorder()
+	c.ServeHTTP(recorder, newPreflightRequest("https://example.com", http.MethodGet, t))
+	if got := recorder.Header().Get("Access-Control-Max-Age"); got != "86400" {
+		t.Fatalf("unexpected max age %q", got)
+	}
+	if c.MaxAge() != 30*24*time.Hour {
+		t.Fatalf("unexpected configured max age %v", c.MaxAge())
+	}
+	if !strings.Contains(logged.String(), "capped") {
+		t.Fatalf("expected capping to be logged, got %q", logged.String())
+	}
+
+	for age, expected := range map[time.Duration]string{time.Hour: "3600", -1: "-1"} {
+		recorder = httptest.NewRecorder()
+		New(WithOrigins("https://example.com"), WithMaxAgeCap(), WithMaxAge(age)).ServeHTTP(recorder, newPreflightRequest("https://example.com", http.MethodGet, t))
+		if got := recorder.Header().Get("Access-Control-Max-Age"); got != expected {
+			t.Fatalf("unexpected max age %q for %v", got, age)
+		}
+	}
+}
+
+func TestMethodsFunc(t *testing.T) {
+	c := New(WithOrigins("https://example.com"), WithMethods(http.MethodGet),
+		WithMethodsFunc(func(r *http.Request) []string {
+			switch {
+			case strings.HasPrefix(r.URL.Path, "/files/"):
+				return []string{"put", http.MethodDelete, http.MethodGet}
+			case strings.HasPrefix(r.URL.Path, "/forms/"):
+				return []string{http.MethodPost}
+			}
+			return nil
+		}))
+	h := c.Wrap(http.NotFoundHandler())
+
+	tests := []struct {
+		path, method, expected string
+	}{
+		{"/files/a.txt", http.MethodDelete, "GET, PUT, DELETE"},
+		{"/forms/contact", http.MethodPost, "GET, POST"},
+		{"/forms/contact", http.MethodPut, ""},
+		{"/", http.MethodGet, "GET"},
+	}
+	for _, tt := range tests {
+		req := newPreflightRequest("https://example.com", tt.method, t)
+		req.URL.Path = tt.path
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, req)
+		if got := recorder.Header().Get("Access-Control-Allow-Methods"); got != tt.expected {
+			t.Errorf("%s %s: got allowed methods %q, expected %q", tt.method, tt.path, got, tt.expected)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	c := New(WithOrigins("https://example.com"), WithMethods(http.MethodGet), WithHeaders("Content-Type"),
+		WithMaxAge(time.Hour), WithCredentials(true), WithExposedHeaders("X-Total"), WithVary("X-Tenant"), WithStrictOrigin())
+	c.Reset()
+
+	h := c.Wrap(http.NotFoundHandler())
+	for _, req := range []*http.Request{
+		newRequest(http.MethodGet, "https://example.com", t),
+		newPreflightRequest("https://example.com", http.MethodGet, t),
+		newRequest(http.MethodGet, "https://evil.com", t),
+	} {
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, req)
+		for k := range recorder.Header() {
+			if strings.HasPrefix(k, "Access-Control-") || k == "Vary" {
+				t.Errorf("%s: unexpected header %s", req.Method, k)
+			}
+		}
+	}
+
+	c.Update(WithOrigins("https://example.com"))
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, newRequest(http.MethodGet, "https://example.com", t))
+	if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != "https://example.com" {
+		t.Fatalf("unexpected allowed origin %q after Update", got)
+	}
+}
+
+func TestResetKeepsMounted(t *testing.T) {
+	c := New(WithOrigins("https://example.com")).Mount(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "app")
+	}))
+	c.Reset()
+
+	recorder := httptest.NewRecorder()
+	c.ServeHTTP(recorder, newRequest(http.MethodGet, "https://example.com", t))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "app" {
+		t.Fatalf("unexpected response %d %q", recorder.Code, recorder.Body)
+	}
+	validateHeaders("", "", "", "", recorder, t)
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	var order []string
+	tag := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	chain := func(h http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			h = middlewares[i](h)
+		}
+		return h
+	}
+
+	c := New(WithOrigins("https://example.com"), WithMethods(http.MethodGet))
+	h := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}), tag("logging"), c.Middleware(), tag("auth"))
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, newRequest(http.MethodGet, "https://example.com", t))
+	if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != "https://example.com" {
+		t.Fatalf("unexpected allowed origin %q", got)
+	}
+	if !equalStrings(order, "logging", "auth", "handler") {
+		t.Fatalf("unexpected order %q", order)
+	}
+
+	order = nil
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, newPreflightRequest("https://example.com", http.MethodGet, t))
+	if recorder.Code != http.StatusNoContent || !equalStrings(order, "logging") {
+		t.Fatalf("unexpected preflight response %d with order %q", recorder.Code, order)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	validator := func(origin string) bool { return strings.HasSuffix(origin, ".example.com") }
+	withValidator := WithOriginValidator(validator)
+	configs := func() []ConfigFunc {
+		return []ConfigFunc{
+			WithOrigins("https://example.com"), WithOriginPatterns("https://*.example.org"), withValidator,
+			WithMethods(http.MethodGet, http.MethodPost), WithHeaders("Content-Type"), WithMaxAge(time.Hour),
+			WithCredentials(true), WithOriginMethods("https://example.com", http.MethodPut),
+		}
+	}
+	a, b, c := New(configs()...), New(configs()...), New(configs()...)
+
+	if !Equal(a, a) {
+		t.Error("expected Equal to be reflexive")
+	}
+	if !Equal(a, b) || !Equal(b, a) {
+		t.Error("expected Equal to be symmetric")
+	}
+	if !Equal(a, b) || !Equal(b, c) || !Equal(a, c) {
+		t.Error("expected Equal to be transitive")
+	}
+	if !Equal(a, a.Clone()) {
+		t.Error("expected a clone to be equal")
+	}
+	if !Equal(nil, nil) || Equal(a, nil) || Equal(nil, a) {
+		t.Error("unexpected result comparing with nil")
+	}
+	if !Equal(New(), &Cors{}) {
+		t.Error("expected unconfigured Cors to be equal")
+	}
+
+	for name, config := range map[string]ConfigFunc{
+		"origins":   WithOrigins("https://example.net"),
+		"patterns":  WithOriginPatterns("https://*.example.net"),
+		"validator": WithOriginValidator(func(origin string) bool { return false }),
+		"methods":   WithMethods(http.MethodGet),
+		"headers":   WithHeaders("Content-Type", "Authorization"),
+		"maxAge":    WithMaxAge(2 * time.Hour),
+		"handler":   func(c *Cors) { c.handler = http.NotFoundHandler() },
+		"errors":    WithMaxAgeSeconds(-1),
+		"logger":    WithLogger(func(r *http.Request, decision string) {}),
+	} {
+		d := New(append(configs(), config)...)
+		if Equal(a, d) || Equal(d, a) {
+			t.Errorf("%s: expected Cors to differ", name)
+		}
+	}
+}
+
+func TestEqualFuncs(t *testing.T) {
+	mk := func(allowed string) ConfigFunc {
+		return WithOriginValidator(func(origin string) bool { return origin == allowed })
+	}
+	if Equal(New(mk("https://a.com")), New(mk("https://evil.com"))) {
+		t.Error("expected validators from the same factory to differ")
+	}
+	validator := func(origin string) bool { return true }
+	if Equal(New(WithOriginValidator(validator)), New(WithOriginValidator(validator))) {
+		t.Error("expected validators set by different ConfigFuncs to differ")
+	}
+
+	c := New(mk("https://a.com"), WithHeadersFunc(func(r *http.Request) []string { return nil }),
+		WithRejectionHandler(http.NotFound))
+	if !Equal(c, c.Clone()) || !Equal(c.Clone(), c.Clone(WithMaxAge(0))) {
+		t.Error("expected clones to be equal")
+	}
+	if Equal(c, c.Clone(WithHeadersFunc(func(r *http.Request) []string { return nil }))) {
+		t.Error("expected a replaced headers function to differ")
+	}
+
+	mux := http.NewServeMux()
+	if !Equal(New().Mount(mux), New().Mount(mux)) || Equal(New().Mount(mux), New().Mount(http.NewServeMux())) {
+		t.Error("expected mounted handlers to be compared by address")
+	}
+	if Equal(New().Mount(http.NotFoundHandler()), New().Mount(http.NotFoundHandler())) {
+		t.Error("expected mounted handler functions to differ")
+	}
+
+	var buf bytes.Buffer
+	l := log.New(&buf, "", 0)
+	if !Equal(New(WithDebugLogger(l)), New(WithDebugLogger(l))) || Equal(New(WithDebugLogger(l)), New(WithDebugLogger(log.New(&buf, "", 0)))) {
+		t.Error("expected debug loggers to be compared by address")
+	}
+}
+
+func TestGRPCWeb(t *testing.T) {
+	c := GRPCWeb("https://app.example.com")
+	h := c.Wrap(http.NotFoundHandler())
+
+	req := newPreflightRequest("https://app.example.com", http.MethodPost, t)
+	req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web,x-user-agent")
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, req)
+	validateHeaders("https://app.example.com", http.MethodPost, "Content-Type, X-Grpc-Web, X-User-Agent, Grpc-Timeout", "", recorder, t)
+
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, newRequest(http.MethodPost, "https://app.example.com", t))
+	if got := recorder.Header().Get("Access-Control-Expose-Headers"); got != "Grpc-Status, Grpc-Message, Grpc-Status-Details-Bin" {
+		t.Fatalf("unexpected exposed headers %q", got)
+	}
+
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, newRequest(http.MethodPost, "https://evil.com", t))
+	if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("unexpected allowed origin %q", got)
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	c := New(WithOrigins("https://example.com"), WithMethods(http.MethodGet)).Freeze()
+
+	for name, fn := range map[string]func(){
+		"Update":     func() { c.Update(WithOrigins("https://evil.com")) },
+		"SetOrigins": func() { c.SetOrigins("https://evil.com") },
+		"Reset":      c.Reset,
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "frozen") {
+					t.Errorf("%s: expected a panic about the Cors being frozen, got %v", name, r)
+				}
+			}()
+			fn()
+		}()
+	}
+
+	recorder := httptest.NewRecorder()
+	c.Wrap(http.NotFoundHandler()).ServeHTTP(recorder, newPreflightRequest("https://example.com", http.MethodGet, t))
+	validateHeaders("https://example.com", http.MethodGet, "", "", recorder, t)
+
+	clone := c.Clone()
+	clone.Update(WithOrigins("https://example.org"))
+	if !equalStrings(clone.AllowedOrigins(), "https://example.org") || !equalStrings(c.AllowedOrigins(), "https://example.com") {
+		t.Fatalf("unexpected origins %q and %q", clone.AllowedOrigins(), c.AllowedOrigins())
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	c := New(WithOrigins("https://example.com", "https://*.example.org"))
+	upgrade := func(origin string) *http.Request {
+		req := newRequest(http.MethodGet, origin, t)
+		req.Host = "ws.example.net"
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		return req
+	}
+
+	for origin, expected := range map[string]bool{
+		"https://example.com":     true,
+		"https://app.example.org": true,
+		"https://ws.example.net":  true,
+		"":                        true,
+		"https://evil.com":        false,
+		"null":                    false,
+	} {
+		if got := c.CheckOrigin(upgrade(origin)); got != expected {
+			t.Errorf("%q: got %v, expected %v", origin, got, expected)
+		}
+	}
+
+	override := New(WithOrigins("https://evil.com"))
+	req := upgrade("https://evil.com")
+	if !c.CheckOrigin(req.WithContext(WithContextOverride(req.Context(), override))) {
+		t.Fatal("expected the context override to be used")
+	}
+}
+
+func TestStrictOriginOptionalOrigin(t *testing.T) {
+	var decisions []string
+	called := false
+	c := New(WithOrigins("https://example.com"), WithMethods(http.MethodPost), WithStrictOrigin(), WithRequireOriginHeader(false),
+		WithLogger(func(r *http.Request, decision string) {
+			decisions = append(decisions, decision)
+		}))
+	h := c.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, newRequest(http.MethodPost, "", t))
+	if recorder.Code != http.StatusOK || !called {
+		t.Fatalf("unexpected status %d, handler called %v", recorder.Code, called)
+	}
+	if got := recorder.Header().Get("Access-Control-Allow-Methods"); got != http.MethodPost {
+		t.Fatalf("unexpected allowed methods %q", got)
+	}
+
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, newRequest(http.MethodPost, "https://evil.com", t))
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("unexpected status %d", recorder.Code)
+	}
+	if !equalStrings(decisions, "no-origin", "rejected") {
+		t.Fatalf("unexpected decisions %q", decisions)
+	}
+}
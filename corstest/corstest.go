@@ -0,0 +1,122 @@
+// Package corstest provides helpers for checking the CORS headers of HTTP
+// responses in tests.
+package corstest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// HasCORSHeaders reports whether the headers contain a non-empty
+// Access-Control-Allow-Origin header, meaning the response is readable by
+// at least one other origin.
+func HasCORSHeaders(h http.Header) bool {
+	return h.Get("Access-Control-Allow-Origin") != ""
+}
+
+// ValidateCORSResponse checks the CORS headers of a response against the
+// rules browsers enforce and returns an error describing the first
+// violation found. When credentialed is true the response is checked as a
+// response to a request with credentials, where wildcards aren't allowed and
+// Access-Control-Allow-Credentials must be "true".
+func ValidateCORSResponse(h http.Header, credentialed bool) error {
+	origins := h.Values("Access-Control-Allow-Origin")
+	switch {
+	case len(origins) == 0 || origins[0] == "":
+		return errors.New("corstest: missing Access-Control-Allow-Origin header")
+	case len(origins) > 1 || strings.Contains(origins[0], ","):
+		return fmt.Errorf("corstest: Access-Control-Allow-Origin must be a single origin, got %q", strings.Join(origins, ", "))
+	}
+
+	if v := h.Get("Access-Control-Allow-Credentials"); v != "" && v != "true" {
+		return fmt.Errorf("corstest: Access-Control-Allow-Credentials must be \"true\" if present, got %q", v)
+	}
+
+	if v := h.Get("Access-Control-Max-Age"); v != "" {
+		if _, err := strconv.Atoi(v); err != nil {
+			return fmt.Errorf("corstest: Access-Control-Max-Age must be an integer, got %q", v)
+		}
+	}
+
+	if !credentialed {
+		return nil
+	}
+
+	if h.Get("Access-Control-Allow-Credentials") != "true" {
+		return errors.New("corstest: missing Access-Control-Allow-Credentials header for credentialed request")
+	}
+	for _, k := range []string{
+		"Access-Control-Allow-Origin",
+		"Access-Control-Allow-Methods",
+		"Access-Control-Allow-Headers",
+		"Access-Control-Expose-Headers",
+	} {
+		for _, v := range h.Values(k) {
+			for _, field := range strings.Split(v, ",") {
+				if strings.TrimSpace(field) == "*" {
+					return fmt.Errorf("corstest: %s can't be \"*\" for credentialed request", k)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// AssertAllowed sends a preflight request from origin to handler, asking for
+// the GET method, and reports an error on t unless it is answered with 204
+// No Content and an Access-Control-Allow-Origin header accepting origin.
+func AssertAllowed(t testing.TB, handler http.Handler, origin string) {
+	t.Helper()
+
+	recorder := preflight(handler, origin)
+	if recorder.Code != http.StatusNoContent {
+		t.Errorf("preflight from %q: got status %d, want %d", origin, recorder.Code, http.StatusNoContent)
+	}
+	if v := recorder.Header().Get("Access-Control-Allow-Origin"); v != origin && v != "*" {
+		t.Errorf("preflight from %q: got Access-Control-Allow-Origin %q", origin, v)
+	}
+}
+
+// AssertRejected sends a preflight request from origin to handler, asking
+// for the GET method, and reports an error on t if the response has an
+// Access-Control-Allow-Origin header.
+func AssertRejected(t testing.TB, handler http.Handler, origin string) {
+	t.Helper()
+
+	recorder := preflight(handler, origin)
+	if v := recorder.Header().Get("Access-Control-Allow-Origin"); v != "" {
+		t.Errorf("preflight from %q: got Access-Control-Allow-Origin %q, want none", origin, v)
+	}
+}
+
+// AssertExposeHeaders sends a GET request from origin to handler and
+// reports an error on t unless the Access-Control-Expose-Headers header of
+// the response is want.
+func AssertExposeHeaders(t testing.TB, handler http.Handler, origin, want string) {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Origin", origin)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+	if v := strings.Join(recorder.Header().Values("Access-Control-Expose-Headers"), ", "); v != want {
+		t.Errorf("request from %q: got Access-Control-Expose-Headers %q, want %q", origin, v, want)
+	}
+}
+
+// preflight sends a preflight request from origin to handler.
+func preflight(handler http.Handler, origin string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodOptions, "/", nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+
+	return recorder
+}
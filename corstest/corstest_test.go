@@ -0,0 +1,107 @@
+package corstest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mbanzon/cors"
+)
+
+func TestHasCORSHeaders(t *testing.T) {
+	h := http.Header{}
+	if HasCORSHeaders(h) {
+		t.Fatal("expected no CORS headers")
+	}
+
+	h.Set("Access-Control-Allow-Origin", "")
+	if HasCORSHeaders(h) {
+		t.Fatal("expected no CORS headers for empty value")
+	}
+
+	h.Set("Access-Control-Allow-Origin", "https://example.com")
+	if !HasCORSHeaders(h) {
+		t.Fatal("expected CORS headers")
+	}
+}
+
+func TestValidateCORSResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		credentialed bool
+		valid        bool
+	}{
+		{"origin", map[string]string{"Access-Control-Allow-Origin": "https://example.com"}, false, true},
+		{"wildcard", map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Headers": "*"}, false, true},
+		{"missing origin", map[string]string{"Access-Control-Allow-Methods": "GET"}, false, false},
+		{"multiple origins", map[string]string{"Access-Control-Allow-Origin": "https://a.com, https://b.com"}, false, false},
+		{"invalid credentials", map[string]string{"Access-Control-Allow-Origin": "https://a.com", "Access-Control-Allow-Credentials": "false"}, false, false},
+		{"invalid max age", map[string]string{"Access-Control-Allow-Origin": "https://a.com", "Access-Control-Max-Age": "1h"}, false, false},
+		{"credentialed", map[string]string{"Access-Control-Allow-Origin": "https://a.com", "Access-Control-Allow-Credentials": "true", "Access-Control-Allow-Methods": "GET"}, true, true},
+		{"credentialed missing credentials", map[string]string{"Access-Control-Allow-Origin": "https://a.com"}, true, false},
+		{"credentialed wildcard origin", map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Credentials": "true"}, true, false},
+		{"credentialed wildcard headers", map[string]string{"Access-Control-Allow-Origin": "https://a.com", "Access-Control-Allow-Credentials": "true", "Access-Control-Allow-Headers": "X-Foo, *"}, true, false},
+	}
+
+	for _, test := range tests {
+		h := http.Header{}
+		for k, v := range test.headers {
+			h.Set(k, v)
+		}
+		if err := ValidateCORSResponse(h, test.credentialed); (err == nil) != test.valid {
+			t.Fatalf("%s: unexpected result: %v", test.name, err)
+		}
+	}
+}
+
+// recordingTB records whether a test helper reported an error.
+type recordingTB struct {
+	testing.TB
+	failed bool
+}
+
+func (tb *recordingTB) Helper() {}
+
+func (tb *recordingTB) Errorf(format string, args ...interface{}) {
+	tb.failed = true
+}
+
+func TestAssertAllowed(t *testing.T) {
+	handler := cors.New(cors.WithOrigins("https://a.com"), cors.WithMethods(http.MethodGet)).Wrap(http.NotFoundHandler())
+	AssertAllowed(t, handler, "https://a.com")
+	AssertAllowed(t, cors.New(cors.WithOrigins("*")).Wrap(http.NotFoundHandler()), "https://a.com")
+
+	tb := &recordingTB{TB: t}
+	AssertAllowed(tb, handler, "https://b.com")
+	if !tb.failed {
+		t.Fatal("expected AssertAllowed to fail for rejected origin")
+	}
+
+	tb = &recordingTB{TB: t}
+	AssertAllowed(tb, http.NotFoundHandler(), "https://a.com")
+	if !tb.failed {
+		t.Fatal("expected AssertAllowed to fail without CORS")
+	}
+}
+
+func TestAssertRejected(t *testing.T) {
+	handler := cors.New(cors.WithOrigins("https://a.com"), cors.WithMethods(http.MethodGet)).Wrap(http.NotFoundHandler())
+	AssertRejected(t, handler, "https://b.com")
+
+	tb := &recordingTB{TB: t}
+	AssertRejected(tb, handler, "https://a.com")
+	if !tb.failed {
+		t.Fatal("expected AssertRejected to fail for allowed origin")
+	}
+}
+
+func TestAssertExposeHeaders(t *testing.T) {
+	handler := cors.New(cors.WithOrigins("https://a.com"), cors.WithExposedHeaders("X-Foo", "X-Bar")).Wrap(http.NotFoundHandler())
+	AssertExposeHeaders(t, handler, "https://a.com", "X-Foo, X-Bar")
+
+	tb := &recordingTB{TB: t}
+	AssertExposeHeaders(tb, handler, "https://a.com", "X-Foo")
+	if !tb.failed {
+		t.Fatal("expected AssertExposeHeaders to fail for other headers")
+	}
+}
@@ -0,0 +1,34 @@
+// Package echocors adapts the cors middleware for use with the Echo web
+// framework.
+package echocors
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mbanzon/cors"
+)
+
+// Middleware returns an echo.MiddlewareFunc that applies the CORS headers
+// of c to the response. Preflight requests are answered without calling the
+// next handler, all other requests continue to the next handler.
+func Middleware(c *cors.Cors) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			var err error
+			res := ctx.Response()
+			c.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// With cors.WithDeferToExisting the CORS headers are only
+				// added when the response is written through w, so the
+				// next handler must write through it too.
+				if w != http.ResponseWriter(res) {
+					ctx.SetResponse(echo.NewResponse(w, ctx.Echo()))
+					defer ctx.SetResponse(res)
+				}
+				err = next(ctx)
+			})).ServeHTTP(res, ctx.Request())
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package echocors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mbanzon/cors"
+)
+
+func newServer(called *bool) *echo.Echo {
+	e := echo.New()
+	e.Use(Middleware(cors.New(cors.WithOrigins("Foo"), cors.WithMethods(http.MethodPut))))
+	handler := func(ctx echo.Context) error {
+		*called = true
+		return ctx.NoContent(http.StatusAccepted)
+	}
+	e.PUT("/", handler)
+	e.OPTIONS("/", handler)
+
+	return e
+}
+
+func TestPreflight(t *testing.T) {
+	called := false
+	e := newServer(&called)
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "Foo")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, req)
+
+	if called {
+		t.Fatal("handler called for preflight request")
+	}
+	if recorder.Code != http.StatusNoContent {
+		t.Fatal("unexpected status code:", recorder.Code)
+	}
+	if val := recorder.Header().Get("Access-Control-Allow-Origin"); val != "Foo" {
+		t.Fatal("unexpected header for \"Access-Control-Allow-Origin\":", val)
+	}
+	if val := recorder.Header().Get("Access-Control-Allow-Methods"); val != http.MethodPut {
+		t.Fatal("unexpected header for \"Access-Control-Allow-Methods\":", val)
+	}
+}
+
+func TestActual(t *testing.T) {
+	called := false
+	e := newServer(&called)
+
+	req := httptest.NewRequest(http.MethodPut, "/", nil)
+	req.Header.Set("Origin", "Foo")
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, req)
+
+	if !called {
+		t.Fatal("handler not called")
+	}
+	if recorder.Code != http.StatusAccepted {
+		t.Fatal("unexpected status code:", recorder.Code)
+	}
+	if val := recorder.Header().Get("Access-Control-Allow-Origin"); val != "Foo" {
+		t.Fatal("unexpected header for \"Access-Control-Allow-Origin\":", val)
+	}
+}
+
+func TestHandlerError(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware(cors.New(cors.WithOrigins("Foo"))))
+	e.GET("/", func(ctx echo.Context) error {
+		return echo.NewHTTPError(http.StatusTeapot)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "Foo")
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusTeapot {
+		t.Fatal("unexpected status code:", recorder.Code)
+	}
+}
+
+func TestDeferToExisting(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware(cors.New(cors.WithOrigins("Foo"), cors.WithMethods(http.MethodGet), cors.WithDeferToExisting())))
+	e.GET("/", func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, "ok")
+	})
+	e.GET("/bespoke", func(ctx echo.Context) error {
+		ctx.Response().Header().Set("Access-Control-Allow-Methods", http.MethodPost)
+		return ctx.String(http.StatusOK, "ok")
+	})
+
+	for path, methods := range map[string]string{"/": http.MethodGet, "/bespoke": http.MethodPost} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Origin", "Foo")
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, req)
+
+		header := recorder.Result().Header
+		if val := header.Get("Access-Control-Allow-Origin"); val != "Foo" {
+			t.Fatalf("%s: unexpected header for \"Access-Control-Allow-Origin\": %q", path, val)
+		}
+		if val := header.Get("Access-Control-Allow-Methods"); val != methods {
+			t.Fatalf("%s: unexpected header for \"Access-Control-Allow-Methods\": %q", path, val)
+		}
+		if recorder.Code != http.StatusOK || recorder.Body.String() != "ok" {
+			t.Fatalf("%s: unexpected response %d %q", path, recorder.Code, recorder.Body)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set("Origin", "Foo")
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, req)
+	if val := recorder.Result().Header.Get("Access-Control-Allow-Origin"); recorder.Code != http.StatusNotFound || val != "Foo" {
+		t.Fatalf("unexpected error response %d with \"Access-Control-Allow-Origin\": %q", recorder.Code, val)
+	}
+}
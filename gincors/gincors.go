@@ -0,0 +1,28 @@
+// Package gincors adapts the cors middleware for use with the gin web
+// framework.
+package gincors
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mbanzon/cors"
+)
+
+// Middleware returns a gin.HandlerFunc that applies the CORS headers of c
+// to the response. Preflight requests are answered and the context aborted,
+// all other requests continue to the next handler.
+func Middleware(c *cors.Cors) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		next := false
+		c.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next = true
+		})).ServeHTTP(ctx.Writer, ctx.Request)
+
+		if !next {
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,96 @@
+package gincors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mbanzon/cors"
+)
+
+func newRouter(called *bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware(cors.New(cors.WithOrigins("Foo"), cors.WithMethods(http.MethodPut), cors.WithPreflightStatus(http.StatusOK))))
+	handler := func(ctx *gin.Context) {
+		*called = true
+		ctx.Status(http.StatusAccepted)
+	}
+	router.PUT("/", handler)
+	router.OPTIONS("/", handler)
+
+	return router
+}
+
+func TestPreflight(t *testing.T) {
+	called := false
+	router := newRouter(&called)
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "Foo")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if called {
+		t.Fatal("handler called for preflight request")
+	}
+	if recorder.Code != http.StatusOK {
+		t.Fatal("unexpected status code:", recorder.Code)
+	}
+	if val := recorder.Header().Get("Access-Control-Allow-Origin"); val != "Foo" {
+		t.Fatal("unexpected header for \"Access-Control-Allow-Origin\":", val)
+	}
+	if val := recorder.Header().Get("Access-Control-Allow-Methods"); val != http.MethodPut {
+		t.Fatal("unexpected header for \"Access-Control-Allow-Methods\":", val)
+	}
+}
+
+func TestActual(t *testing.T) {
+	called := false
+	router := newRouter(&called)
+
+	req := httptest.NewRequest(http.MethodPut, "/", nil)
+	req.Header.Set("Origin", "Foo")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if !called {
+		t.Fatal("handler not called")
+	}
+	if recorder.Code != http.StatusAccepted {
+		t.Fatal("unexpected status code:", recorder.Code)
+	}
+	if val := recorder.Header().Get("Access-Control-Allow-Origin"); val != "Foo" {
+		t.Fatal("unexpected header for \"Access-Control-Allow-Origin\":", val)
+	}
+}
+
+func TestDeferToExisting(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware(cors.New(cors.WithOrigins("Foo"), cors.WithMethods(http.MethodGet), cors.WithDeferToExisting())))
+	router.GET("/", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "ok")
+	})
+	router.GET("/bespoke", func(ctx *gin.Context) {
+		ctx.Header("Access-Control-Allow-Methods", http.MethodPost)
+		ctx.String(http.StatusOK, "ok")
+	})
+
+	for path, methods := range map[string]string{"/": http.MethodGet, "/bespoke": http.MethodPost} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Origin", "Foo")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		header := recorder.Result().Header
+		if val := header.Get("Access-Control-Allow-Origin"); val != "Foo" {
+			t.Fatalf("%s: unexpected header for \"Access-Control-Allow-Origin\": %q", path, val)
+		}
+		if val := header.Get("Access-Control-Allow-Methods"); val != methods {
+			t.Fatalf("%s: unexpected header for \"Access-Control-Allow-Methods\": %q", path, val)
+		}
+	}
+}
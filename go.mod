@@ -1,3 +1,5 @@
 module github.com/mbanzon/cors
 
 go 1.17
+
+require github.com/go-chi/chi/v5 v5.0.12
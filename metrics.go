@@ -0,0 +1,55 @@
+//go:build go1.19
+
+package cors
+
+import "sync/atomic"
+
+// Metrics counts the decisions made for the requests handled by a Cors,
+// see WithMetrics. The counters can be read at any time while requests are
+// being handled.
+type Metrics struct {
+	// Allowed counts requests from accepted origins that aren't preflight
+	// requests.
+	Allowed atomic.Int64
+	// Rejected counts requests, including preflight requests, from origins
+	// that aren't accepted.
+	Rejected atomic.Int64
+	// Preflight counts preflight requests from accepted origins.
+	Preflight atomic.Int64
+	// NoOrigin counts requests without an Origin header.
+	NoOrigin atomic.Int64
+}
+
+// Reset sets all the counters to zero.
+func (m *Metrics) Reset() {
+	m.Allowed.Store(0)
+	m.Rejected.Store(0)
+	m.Preflight.Store(0)
+	m.NoOrigin.Store(0)
+}
+
+// WithMetrics returns a ConfigFunc that configures the Cors to count the
+// decision made for every request in m. The same Metrics can be shared by
+// several Cors instances. A nil m disables counting.
+func WithMetrics(m *Metrics) ConfigFunc {
+	return func(c *Cors) {
+		if m == nil {
+			c.metrics, c.ids.metrics = nil, nil
+			return
+		}
+
+		c.ids.metrics = m
+		c.metrics = func(decision string) {
+			switch decision {
+			case "allowed":
+				m.Allowed.Add(1)
+			case "rejected":
+				m.Rejected.Add(1)
+			case "preflight":
+				m.Preflight.Add(1)
+			case "no-origin":
+				m.NoOrigin.Add(1)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+//go:build go1.19
+
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	var m Metrics
+	wrapped := New(WithOrigins("https://example.com"), WithMethods(http.MethodGet), WithMetrics(&m)).Wrap(emptyHandler)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, r := range []*http.Request{
+				httptest.NewRequest(http.MethodGet, "/", nil),
+				httptest.NewRequest(http.MethodGet, "/", nil),
+				httptest.NewRequest(http.MethodGet, "/", nil),
+				httptest.NewRequest(http.MethodOptions, "/", nil),
+			} {
+				r.Header.Set("Origin", "https://example.com")
+				wrapped.ServeHTTP(httptest.NewRecorder(), r)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, origin := range []string{"https://other.com", ""} {
+		r := httptest.NewRequest(http.MethodOptions, "/", nil)
+		r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		wrapped.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	r := httptest.NewRequest(http.MethodOptions, "/", nil)
+	r.Header.Set("Origin", "https://example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	wrapped.ServeHTTP(httptest.NewRecorder(), r)
+
+	if m.Allowed.Load() != 40 || m.Rejected.Load() != 1 || m.Preflight.Load() != 1 || m.NoOrigin.Load() != 1 {
+		t.Fatal("unexpected counters:", m.Allowed.Load(), m.Rejected.Load(), m.Preflight.Load(), m.NoOrigin.Load())
+	}
+
+	m.Reset()
+	if m.Allowed.Load() != 0 || m.Rejected.Load() != 0 || m.Preflight.Load() != 0 || m.NoOrigin.Load() != 0 {
+		t.Fatal("counters not reset")
+	}
+}
+
+func TestEqualMetrics(t *testing.T) {
+	var m1, m2 Metrics
+	if !Equal(New(WithMetrics(&m1)), New(WithMetrics(&m1))) {
+		t.Error("expected the same Metrics to be equal")
+	}
+	if Equal(New(WithMetrics(&m1)), New(WithMetrics(&m2))) {
+		t.Error("expected different Metrics to differ")
+	}
+	if Equal(New(WithMetrics(&m1)), New()) {
+		t.Error("expected Metrics to differ from none")
+	}
+}
@@ -0,0 +1,86 @@
+package cors
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Registry holds a Cors per host, allowing a multi-tenant server to apply a
+// different CORS policy depending on the Host of the request. The zero value
+// is an empty registry ready to use, and a Registry is safe for concurrent
+// use.
+type Registry struct {
+	mu       sync.RWMutex
+	policies map[string]*Cors
+}
+
+// Register adds the Cors to use for requests to the given host. Hosts are
+// compared case-insensitively and a host registered without a port matches
+// requests to any port. It returns an error if the host is empty, c is nil
+// or the host is already registered.
+func (reg *Registry) Register(host string, c *Cors) error {
+	host = strings.ToLower(host)
+	if host == "" {
+		return errors.New("cors: empty host")
+	}
+	if c == nil {
+		return fmt.Errorf("cors: nil Cors for host %q", host)
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, ok := reg.policies[host]; ok {
+		return fmt.Errorf("cors: host %q already registered", host)
+	}
+	if reg.policies == nil {
+		reg.policies = map[string]*Cors{}
+	}
+	reg.policies[host] = c
+
+	return nil
+}
+
+// Select returns the Cors registered for the host, if any. A host with a
+// port is matched against the host registered with the port first and then
+// without it.
+func (reg *Registry) Select(host string) (*Cors, bool) {
+	host = strings.ToLower(host)
+
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	if c, ok := reg.policies[host]; ok {
+		return c, true
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		c, ok := reg.policies[h]
+		return c, ok
+	}
+
+	return nil, false
+}
+
+// Handler returns a http.Handler that applies the Cors registered for the
+// Host of the request before calling h, like Wrap does. Requests to hosts
+// that aren't registered use fallback, or are passed on to h without CORS
+// headers if fallback is nil.
+func (reg *Registry) Handler(fallback *Cors, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, ok := reg.Select(r.Host)
+		if !ok {
+			c = fallback
+		}
+		if c == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		cfg := c.requestConfig(r)
+		cfg.serve(w, r, h)
+	})
+}
@@ -0,0 +1,57 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	var reg Registry
+	if err := reg.Register("a.example.com", New(WithOrigins("https://a.com"), WithMethods(http.MethodGet))); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := reg.Register("B.example.com", New(WithOrigins("https://b.com"), WithMethods(http.MethodPost))); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := reg.Register("a.example.com", New()); err == nil {
+		t.Fatal("expected error for duplicate host")
+	}
+	if err := reg.Register("", New()); err == nil {
+		t.Fatal("expected error for empty host")
+	}
+	if err := reg.Register("c.example.com", nil); err == nil {
+		t.Fatal("expected error for nil Cors")
+	}
+
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := reg.Handler(New(WithOrigins("https://fallback.com"), WithMethods(http.MethodPut)), emptyHandler)
+	for _, test := range []struct {
+		host    string
+		origin  string
+		want    string
+		methods string
+	}{
+		{"a.example.com", "https://a.com", "https://a.com", http.MethodGet},
+		{"a.example.com:8080", "https://a.com", "https://a.com", http.MethodGet},
+		{"a.example.com", "https://b.com", "", http.MethodGet},
+		{"b.example.com", "https://b.com", "https://b.com", http.MethodPost},
+		{"other.example.com", "https://fallback.com", "https://fallback.com", http.MethodPut},
+	} {
+		r := newRequest(http.MethodGet, test.origin, t)
+		r.Host = test.host
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, r)
+		validateHeaders(test.want, test.methods, "", "", recorder, t)
+	}
+
+	called := false
+	r := newRequest(http.MethodGet, "https://a.com", t)
+	r.Host = "other.example.com"
+	recorder := httptest.NewRecorder()
+	reg.Handler(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })).ServeHTTP(recorder, r)
+	validateHeaders("", "", "", "", recorder, t)
+	if !called {
+		t.Fatal("handler not called without fallback")
+	}
+}
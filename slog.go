@@ -0,0 +1,44 @@
+//go:build go1.21
+
+package cors
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// WithSlogLogger returns a ConfigFunc that configures the Cors to log the
+// decision made for every request to l at debug level, with the origin,
+// method, decision and path as attributes. The decisions are the same as
+// those passed to the function given with WithLogger, and both are used if
+// both are configured. A nil l disables logging.
+func WithSlogLogger(l *slog.Logger) ConfigFunc {
+	return func(c *Cors) {
+		if l == nil {
+			c.slogger, c.ids.slogger = nil, nil
+			return
+		}
+
+		c.ids.slogger = l
+		c.slogger = func(r *http.Request, decision string) {
+			ctx := context.Background()
+			var origin, method, path string
+			if r != nil {
+				ctx = r.Context()
+				origin = r.Header.Get("Origin")
+				method = r.Method
+				if r.URL != nil {
+					path = r.URL.Path
+				}
+			}
+
+			l.LogAttrs(ctx, slog.LevelDebug, "cors request",
+				slog.String("origin", origin),
+				slog.String("method", method),
+				slog.String("decision", decision),
+				slog.String("path", path),
+			)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+//go:build go1.21
+
+package cors
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	decisions := 0
+	wrapped := New(WithOrigins("Foo"), WithSlogLogger(logger), WithLogger(func(r *http.Request, decision string) {
+		decisions++
+	})).Wrap(emptyHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	req.Header.Set("Origin", "Bar")
+	wrapped.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := buf.String()
+	for _, attr := range []string{"level=DEBUG", "origin=Bar", "method=GET", "decision=rejected", "path=/api"} {
+		if !strings.Contains(line, attr) {
+			t.Fatalf("missing %q in log record: %s", attr, line)
+		}
+	}
+	if decisions != 1 {
+		t.Fatal("unexpected number of decisions:", decisions)
+	}
+}
+
+func TestSlogLoggerLevel(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	wrapped := New(WithOrigins("Foo"), WithSlogLogger(logger)).Wrap(emptyHandler)
+	wrapped.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodGet, "Foo", t))
+
+	if buf.Len() != 0 {
+		t.Fatal("unexpected log record:", buf.String())
+	}
+}
+
+func TestSlogLoggerNil(t *testing.T) {
+	emptyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	recorder := httptest.NewRecorder()
+	New(WithOrigins("Foo"), WithSlogLogger(nil)).Wrap(emptyHandler).ServeHTTP(recorder, newRequest(http.MethodGet, "Foo", t))
+	validateHeaders("Foo", "", "", "", recorder, t)
+}
+
+func TestEqualSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l1 := slog.New(slog.NewTextHandler(&buf, nil))
+	l2 := slog.New(slog.NewTextHandler(&buf, nil))
+	if !Equal(New(WithSlogLogger(l1)), New(WithSlogLogger(l1))) {
+		t.Error("expected the same logger to be equal")
+	}
+	if Equal(New(WithSlogLogger(l1)), New(WithSlogLogger(l2))) {
+		t.Error("expected different loggers to differ")
+	}
+}